@@ -10,6 +10,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/perun-network/perun-dex-websocket/internal/client"
 	"github.com/perun-network/perun-dex-websocket/internal/deploy/ethereum"
+	"github.com/perun-network/perun-dex-websocket/internal/orderbook"
 	"github.com/perun-network/perun-dex-websocket/internal/websocket"
 )
 
@@ -38,6 +39,9 @@ func run(args []string) {
 		settleTimeout      = runCmd.Duration("settleTimeout", 10*time.Minute, "Timeout for settling channels")
 		runTxFinalityDepth = runCmd.Uint64("finalityDepth", 1, "Number of confirmations required to confirm a blockchain transaction")
 		predefinedGasLimit = runCmd.Bool("predefinedGasLimit", false, "Predefined gas limit for all transactions")
+		orderBookDir       = runCmd.String("orderBookDir", "orderbook_data", "Directory for persisting order books, empty to keep them in memory only")
+		runFeesFile        = runCmd.String("fees", "", "Fee schedule file, empty to trade without fees")
+		channelDir         = runCmd.String("channelDir", "channel_data", "Directory for persisting channels and L2 keys, empty to keep them in memory only")
 	)
 	err := runCmd.Parse(args)
 	if err != nil {
@@ -55,6 +59,13 @@ func run(args []string) {
 		log.Fatalf("parsing chain config file: %v", err)
 	}
 
+	var fees orderbook.FeeSchedule
+	if *runFeesFile != "" {
+		if fees, err = websocket.ParseFeesConfig(*runFeesFile); err != nil {
+			log.Fatalf("parsing fees config file: %v", err)
+		}
+	}
+
 	// Deploy Ethereum contracts.
 	fmt.Println("Deploying Ethereum contracts...")
 	adj, ah := ethereum.DeployContracts(ethChainsConfig.Chains[0].NodeURL, ethChainsConfig.Chains[0].ChainID.Uint64(), ethChainsConfig.Chains[0].DeployerSK)
@@ -70,6 +81,7 @@ func run(args []string) {
 		WSAddress:      *addr,
 		TLSCertificate: *cert,
 		TLSPrivKey:     *certKey,
+		OrderBookDir:   *orderBookDir,
 		ClientConfig: client.Config{
 			EthChains: ethChainsConfig.ChainMap(),
 			SolChains: solChainsConfig.AssetMap(),
@@ -81,6 +93,8 @@ func run(args []string) {
 				SettleTimeout:  *settleTimeout,
 			},
 			TxFinalityDepth: *runTxFinalityDepth,
+			Fees:            fees,
+			ChannelDir:      *channelDir,
 		},
 	}
 	websocket.Run(cfg)
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gagliardetto/solana-go"
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"github.com/pkg/errors"
+)
+
+// proveOwnership challenges the client to sign a random message with the
+// accounts of the L1 addresses it registers with and verifies the signatures.
+// The Ethereum address is only checked if it is set.
+func proveOwnership(conn *message.Connection, eaddr common.Address, saddr string) error {
+	solAddr, err := solana.PublicKeyFromBase58(saddr)
+	if err != nil {
+		return errors.WithMessage(err, "invalid Solana address")
+	}
+
+	var nonce [32]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return errors.WithMessage(err, "generating challenge")
+	}
+	challenge := fmt.Sprintf("Perun DEX login\nEthereum: %s\nSolana: %s\nNonce: %s",
+		eaddr.Hex(), saddr, hex.EncodeToString(nonce[:]))
+	if err := conn.Write(&message.AuthChallenge{Challenge: challenge}); err != nil {
+		return errors.WithMessage(err, "sending challenge")
+	}
+
+	msg, err := conn.Read()
+	if err != nil {
+		return errors.WithMessage(err, "reading challenge response")
+	}
+	resp, ok := msg.(*message.AuthResponse)
+	if !ok {
+		return errors.Errorf("expected challenge response, got %T", msg)
+	}
+
+	if eaddr != (common.Address{}) {
+		if err := verifyEthSignature(eaddr, []byte(challenge), resp.EthSignature); err != nil {
+			return err
+		}
+	}
+	if !ed25519.Verify(ed25519.PublicKey(solAddr[:]), []byte(challenge), resp.SolSignature) {
+		return errors.New("invalid Solana signature")
+	}
+	return nil
+}
+
+// verifyEthSignature checks that sig is a personal_sign signature of data by
+// addr.
+func verifyEthSignature(addr common.Address, data, sig []byte) error {
+	if len(sig) != crypto.SignatureLength {
+		return errors.New("invalid Ethereum signature length")
+	}
+	// personal_sign returns the recovery ID as 27 or 28.
+	sig = append([]byte{}, sig...)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash(data), sig)
+	if err != nil {
+		return errors.WithMessage(err, "recovering Ethereum signer")
+	}
+	if crypto.PubkeyToAddress(*pub) != addr {
+		return errors.New("invalid Ethereum signature")
+	}
+	return nil
+}
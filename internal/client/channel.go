@@ -88,9 +88,6 @@ func (c *Client) handleUpdateChannel(msg *message.UpdateChannel) (err error) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.Timeouts.HandleTimeout)
-	defer cancel()
-
 	newBals, err := message.MakePerunBals(
 		msg.State.Balance, msg.State.PeerBalance, ch.Idx(), 1-ch.Idx(),
 	)
@@ -98,13 +95,21 @@ func (c *Client) handleUpdateChannel(msg *message.UpdateChannel) (err error) {
 		return err
 	}
 
-	err = ch.Update(ctx, func(s *channel.State) {
+	err = c.updateChannel(ch, func(s *channel.State) {
 		s.Allocation.Balances = newBals
 		s.IsFinal = msg.State.IsFinal
 	})
 	return
 }
 
+// updateChannel proposes the state produced by updater to the peer and waits
+// for the peer's decision. Order fills are settled through here as well.
+func (c *Client) updateChannel(ch *client.Channel, updater func(*channel.State)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeouts.HandleTimeout)
+	defer cancel()
+	return ch.Update(ctx, updater)
+}
+
 func (c *Client) handleCloseChannel(msg *message.CloseChannel) (err error) {
 	ch, ok := c.getChannel(msg.ID)
 	if !ok {
@@ -126,6 +131,9 @@ func (c *Client) handleCloseChannel(msg *message.CloseChannel) (err error) {
 		}
 	}
 
+	// A force-closed channel cannot be updated with fills anymore either.
+	OrderBookEngine.FinalizeChannel(ch.ID())
+
 	ctxSettle, cancel := context.WithTimeout(context.Background(),
 		c.Timeouts.SettleTimeout)
 	defer cancel()
@@ -164,6 +172,9 @@ type watcherEventHandler struct {
 // HandleAdjudicatorEvent handles the concluded event.
 func (h *watcherEventHandler) HandleAdjudicatorEvent(e channel.AdjudicatorEvent) {
 	h.log("HandleAdjudicatorEvent", e)
+	// Once the channel is disputed or concluded on-chain, its orders cannot
+	// be settled anymore.
+	OrderBookEngine.FinalizeChannel(e.ID())
 	if _, ok := e.(*channel.ConcludedEvent); ok {
 		h.log("Received concluded event")
 		ch, ok := h.getChannel(e.ID())
@@ -205,10 +216,7 @@ func (c *Client) channelCreated(ch *client.Channel, chErr error, propID client.P
 		return
 	}
 
-	go func() {
-		err := ch.Watch(&watcherEventHandler{c})
-		c.log(fmt.Sprintf("channel %v: watcher returned: %v", ch.ID(), err))
-	}()
+	c.watchChannel(ch)
 
 	peerClient, ok := c.reg.Get(ch.Params().Parts[1-ch.Idx()][message.EthereumIndex].String())
 	if !ok {
@@ -242,10 +250,27 @@ func (c *Client) channelCreated(ch *client.Channel, chErr error, propID client.P
 	}
 }
 
-// channelClosed removes the channel out of the client's channel map and sends a
-// ChannelClosed message to the client.
+// watchChannel routes the channel's orders to its book, finalizes the book
+// once the channel state is final and starts the channel's watcher.
+func (c *Client) watchChannel(ch *client.Channel) {
+	c.routeOrderBook(ch)
+	ch.OnUpdate(func(_, to *channel.State) {
+		if to.IsFinal {
+			OrderBookEngine.FinalizeChannel(ch.ID())
+		}
+	})
+
+	go func() {
+		err := ch.Watch(&watcherEventHandler{c})
+		c.log(fmt.Sprintf("channel %v: watcher returned: %v", ch.ID(), err))
+	}()
+}
+
+// channelClosed archives the channel's order book and sends a ChannelClosed
+// message to the client.
 func (c *Client) channelClosed(chID channel.ID) {
 	c.log(fmt.Sprintf("Closed channel %x", chID))
+	OrderBookEngine.ArchiveChannel(chID)
 
 	err := c.conn.Write(&message.ChannelClosed{ID: chID})
 	if err != nil {
@@ -4,15 +4,18 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"github.com/perun-network/perun-dex-websocket/internal/orderbook"
 	ethwallet "github.com/perun-network/perun-eth-backend/wallet"
 	"perun.network/go-perun/wallet"
 	"perun.network/go-perun/wire"
 
 	"perun.network/go-perun/channel"
 	"perun.network/go-perun/channel/multi"
+	"perun.network/go-perun/channel/persistence/keyvalue"
 	"perun.network/go-perun/client"
 	"perun.network/go-perun/log"
 )
@@ -24,15 +27,28 @@ type Client struct {
 	conn        *message.Connection
 	perunClient *client.Client
 	adjudicator *multi.Adjudicator
+	// persister persists the client's channels, nil if they are kept in
+	// memory only.
+	persister *keyvalue.PersistRestorer
 
 	solChains SolanaChainMap
 	ethChains EthereumChainMap
 	Timeouts  Timeouts
+	fees      orderbook.FeeSchedule
 
 	chMtx    sync.RWMutex // Protects the channels.
 	channels map[channel.ID]*client.Channel
 
+	orderNonce atomic.Uint64 // Last nonce used for signing an order.
+
+	// cancelOnDisconnect is the client's cancel-on-disconnect setting, nil
+	// if disabled.
+	cancelOnDisconnect atomic.Pointer[cancelPolicy]
+
 	reg *Registry
+
+	done     chan struct{} // Closed on shutdown.
+	doneOnce sync.Once
 }
 
 // NewClient creates a new client.
@@ -50,6 +66,14 @@ func NewClient(
 	}
 	l2AddrEth := walletAddrs[ethwallet.BackendID].(*ethwallet.Address)
 	l2Addr := (*common.Address)(l2AddrEth)
+	var persister *keyvalue.PersistRestorer
+	if cfg.ChannelDir != "" {
+		if persister, err = openPersistRestorer(cfg.ChannelDir, *l2Addr); err != nil {
+			perunClient.Close()
+			return nil, err
+		}
+		perunClient.EnablePersistence(persister)
+	}
 	c := &Client{
 		addr:        *l2Addr,
 		addrs:       walletAddrs,
@@ -57,11 +81,14 @@ func NewClient(
 		conn:        conn,
 		perunClient: perunClient,
 		adjudicator: adjudicator,
+		persister:   persister,
 		channels:    make(map[channel.ID]*client.Channel),
 		solChains:   cfg.SolChains,
 		ethChains:   cfg.EthChains,
 		Timeouts:    cfg.Timeouts,
+		fees:        cfg.Fees,
 		reg:         reg,
+		done:        make(chan struct{}),
 	}
 	return c, nil
 }
@@ -71,6 +98,11 @@ func (c *Client) Run() {
 	defer c.perunClient.Close()
 	defer c.shutdown()
 
+	restored, err := c.restoreChannels()
+	if err != nil {
+		c.log("restoring channels: ", err)
+	}
+
 	cond := sync.NewCond(&sync.Mutex{})
 
 	go func() {
@@ -87,7 +119,7 @@ func (c *Client) Run() {
 	}()
 	c.log("Started")
 
-	err := c.conn.Write(&message.Initialized{L2Address: c.addr})
+	err = c.conn.Write(&message.Initialized{L2Address: c.addr, Channels: restored})
 	if err != nil {
 		c.log("sending initialized", err)
 	}
@@ -150,6 +182,17 @@ func (c *Client) getChannel(id channel.ID) (*client.Channel, bool) {
 	return ch, ok
 }
 
+// allChannels returns all channels of the client.
+func (c *Client) allChannels() []*client.Channel {
+	c.chMtx.RLock()
+	defer c.chMtx.RUnlock()
+	chs := make([]*client.Channel, 0, len(c.channels))
+	for _, ch := range c.channels {
+		chs = append(chs, ch)
+	}
+	return chs
+}
+
 func (c *Client) removeChannel(id channel.ID) {
 	c.chMtx.Lock()
 	defer c.chMtx.Unlock()
@@ -160,6 +203,8 @@ func (c *Client) removeChannel(id channel.ID) {
 }
 
 func (c *Client) shutdown() {
+	c.doneOnce.Do(func() { close(c.done) })
+
 	var err error
 	err = c.conn.Close()
 	if err != nil {
@@ -170,6 +215,18 @@ func (c *Client) shutdown() {
 	if err != nil {
 		c.log(err)
 	}
+
+	// The Perun client does not close its persister.
+	if c.persister != nil {
+		if err := c.persister.Close(); err != nil {
+			c.log("closing channel database: ", err)
+		}
+	}
+}
+
+// Done is closed once the client shuts down.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
 }
 
 func (c *Client) log(v ...interface{}) {
@@ -8,6 +8,7 @@ import (
 	"perun.network/go-perun/channel/multi"
 
 	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"github.com/perun-network/perun-dex-websocket/internal/orderbook"
 )
 
 type (
@@ -18,6 +19,12 @@ type (
 		EthChains       EthereumChainMap
 		SolChains       SolanaChainMap
 		GasLimits       GasLimits
+		// Fees are charged on the fills of consolidated books.
+		Fees orderbook.FeeSchedule
+		// ChannelDir is the directory the channels and L2 keys of the
+		// clients are persisted in. Channels are kept in memory only if it
+		// is empty.
+		ChannelDir string
 	}
 
 	// Timeouts contains the timeouts for the client.
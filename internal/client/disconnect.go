@@ -0,0 +1,83 @@
+package client
+
+import (
+	"time"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+// MaxCancelGracePeriod bounds the time the orders of a disconnected client
+// with cancel-on-disconnect stay in the books.
+const MaxCancelGracePeriod = 10 * time.Minute
+
+// cancelPolicy is the cancel-on-disconnect setting of a client.
+type cancelPolicy struct {
+	grace time.Duration
+}
+
+// setCancelOnDisconnect enables cancel-on-disconnect with the grace period in
+// seconds, or disables it.
+func (c *Client) setCancelOnDisconnect(m *message.SetCancelOnDisconnect) *message.SetCancelOnDisconnectAck {
+	ack := &message.SetCancelOnDisconnectAck{Enabled: m.Enabled, GracePeriod: m.GracePeriod}
+	grace := time.Duration(m.GracePeriod) * time.Second
+	if m.GracePeriod < 0 || grace > MaxCancelGracePeriod {
+		ack.Reason = "grace period must be between 0 and " + MaxCancelGracePeriod.String()
+		return ack
+	}
+	if m.Enabled {
+		c.cancelOnDisconnect.Store(&cancelPolicy{grace: grace})
+	} else {
+		c.cancelOnDisconnect.Store(nil)
+	}
+	ack.Success = true
+	return ack
+}
+
+// cancelOnDisconnect schedules the cancellation of the open orders of a
+// removed client if it enabled cancel-on-disconnect.
+func (r *Registry) cancelOnDisconnect(c *Client) {
+	p := c.cancelOnDisconnect.Load()
+	if p == nil {
+		return
+	}
+	chs := c.allChannels()
+	seats := make([]seat, len(chs))
+	for i, ch := range chs {
+		seats[i] = seat{ch.ID(), ch.Idx()}
+	}
+	c.log("canceling orders after disconnect in ", p.grace)
+	cancelAfter(p.grace, seats, r.attached)
+}
+
+// seat is the place of a participant in a channel.
+type seat struct {
+	chID channel.ID
+	idx  channel.Index
+}
+
+// cancelAfter cancels the orders of the seats once the grace period has
+// passed, except in channels that a returning client took over meanwhile.
+func cancelAfter(grace time.Duration, seats []seat, attached func(channel.ID, channel.Index) bool) {
+	time.AfterFunc(grace, func() {
+		for _, s := range seats {
+			if attached(s.chID, s.idx) {
+				continue
+			}
+			OrderBookEngine.CancelMakerOrders(s.chID, s.idx, message.RemoveDisconnected)
+		}
+	})
+}
+
+// attached reports whether a registered client participates in the channel
+// at index idx.
+func (r *Registry) attached(chID channel.ID, idx channel.Index) bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	for _, c := range r.m {
+		if ch, ok := c.getChannel(chID); ok && ch.Idx() == idx {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"github.com/perun-network/perun-dex-websocket/internal/orderbook"
+	"perun.network/go-perun/channel"
+)
+
+// useEngine replaces the global order book engine for the test.
+func useEngine(t *testing.T) *orderbook.Engine {
+	t.Helper()
+	prev := OrderBookEngine
+	OrderBookEngine = orderbook.NewEngine()
+	t.Cleanup(func() { OrderBookEngine = prev })
+	return OrderBookEngine
+}
+
+// placeOrder places a resting ask of the participant at maker in the book of
+// the channel.
+func placeOrder(t *testing.T, e *orderbook.Engine, chID channel.ID, maker channel.Index) message.OrderID {
+	t.Helper()
+	ack, _ := e.GetOrCreateBook(chID).CreateOrder(message.Order{
+		MakerIdx: maker,
+		Side:     message.SideAsk,
+		Base:     &message.SolanaAsset{Mint: "base"},
+		Quote:    &message.SolanaAsset{Mint: "quote"},
+		Price:    "10",
+		Amount:   "1",
+	}, orderbook.Admission{})
+	if !ack.Accepted {
+		t.Fatalf("order rejected: %s", ack.Reason)
+	}
+	return ack.ID
+}
+
+func TestSetCancelOnDisconnect(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     message.SetCancelOnDisconnect
+		success bool
+		grace   time.Duration // nil policy if negative
+	}{
+		{name: "enable", msg: message.SetCancelOnDisconnect{Enabled: true}, success: true},
+		{name: "enable with grace", msg: message.SetCancelOnDisconnect{Enabled: true, GracePeriod: 600}, success: true, grace: 10 * time.Minute},
+		{name: "disable", msg: message.SetCancelOnDisconnect{}, success: true, grace: -1},
+		{name: "grace too long", msg: message.SetCancelOnDisconnect{Enabled: true, GracePeriod: 601}, grace: -1},
+		{name: "negative grace", msg: message.SetCancelOnDisconnect{Enabled: true, GracePeriod: -1}, grace: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := new(Client)
+			ack := c.setCancelOnDisconnect(&tt.msg)
+			if ack.Success != tt.success {
+				t.Fatalf("success %t (%s), want %t", ack.Success, ack.Reason, tt.success)
+			}
+			p := c.cancelOnDisconnect.Load()
+			switch {
+			case tt.grace < 0 && p != nil:
+				t.Errorf("enabled with grace %s", p.grace)
+			case tt.grace >= 0 && (p == nil || p.grace != tt.grace):
+				t.Errorf("policy %v, want grace %s", p, tt.grace)
+			}
+		})
+	}
+}
+
+func TestCancelAfterGracePeriod(t *testing.T) {
+	e := useEngine(t)
+	gone, returned := channel.ID{1}, channel.ID{2}
+	canceled := placeOrder(t, e, gone, 0)
+	counterparty := placeOrder(t, e, gone, 1)
+	kept := placeOrder(t, e, returned, 0)
+
+	book, _ := e.GetBook(gone)
+	sub := book.Subscribe()
+	defer sub.Close()
+
+	const grace = 50 * time.Millisecond
+	start := time.Now()
+	cancelAfter(grace, []seat{{gone, 0}, {returned, 0}}, func(chID channel.ID, _ channel.Index) bool {
+		return chID == returned
+	})
+
+	select {
+	case d := <-sub.Deltas():
+		if elapsed := time.Since(start); elapsed < grace {
+			t.Errorf("canceled after %s, before the grace period", elapsed)
+		}
+		if len(d.Removed) != 1 || d.Removed[0] != canceled || d.Reasons[canceled] != message.RemoveDisconnected {
+			t.Errorf("removed %v with reasons %v, want order %s as disconnected", d.Removed, d.Reasons, canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("orders not canceled")
+	}
+
+	if _, ok := book.Order(counterparty); !ok {
+		t.Error("order of the counterparty canceled")
+	}
+	other, _ := e.GetBook(returned)
+	if _, ok := other.Order(kept); !ok {
+		t.Error("order in a channel taken over by a returning client canceled")
+	}
+}
@@ -1,46 +1,232 @@
 package client
 
 import (
+	"math/big"
+
 	"github.com/perun-network/perun-dex-websocket/internal/message"
 	"github.com/perun-network/perun-dex-websocket/internal/orderbook"
+	ethwallet "github.com/perun-network/perun-eth-backend/wallet"
+	"github.com/pkg/errors"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/wallet"
 )
 
 // OrderBookEngine is the global order book instance.
 var OrderBookEngine = orderbook.NewEngine()
 
-// HandleOrderBookMessage routes order book messages to the engine.
+// errHubTrade rejects orders of a hub in its own consolidated book, in which it
+// is the counterparty of every trade.
+var errHubTrade = errors.New("the hub cannot trade in its consolidated book")
+
+// HandleOrderBookMessage routes order book messages to the engine. Clients
+// can only use the books of channels they are a participant of and always act
+// as their own index in the channel.
 func (h *requestHandler) HandleOrderBookMessage(msg message.Message) (message.Message, bool) {
 	switch m := msg.(type) {
 	case *message.CreateOrder:
-		book := OrderBookEngine.GetOrCreateBook(m.Order.ChannelID)
-		ack := book.CreateOrder(m.Order)
+		ch, ok := h.getChannel(m.Order.ChannelID)
+		if !ok {
+			return &message.CreateOrderAck{
+				ClientTag: m.Order.ClientTag,
+				Accepted:  false,
+				Reason:    "channel not found",
+			}, true
+		}
+		order := m.Order
+		order.MakerIdx = ch.Idx()
+		reject := func(err error) (message.Message, bool) {
+			return &message.CreateOrderAck{
+				ClientTag: order.ClientTag,
+				Accepted:  false,
+				Reason:    err.Error(),
+			}, true
+		}
+		if err := h.signOrder(&order); err != nil {
+			return reject(err)
+		}
+		signer, err := participantL2Address(ch, order.MakerIdx)
+		if err != nil {
+			return reject(err)
+		}
+		// The balance is read before the book is locked, as reading the
+		// channel state waits for updates in progress.
+		balance, err := h.orderBalance(ch, order)
+		if err != nil {
+			return reject(err)
+		}
+		decimals, err := h.marketDecimals(order)
+		if err != nil {
+			return reject(err)
+		}
+		book := OrderBookEngine.GetOrCreateBook(order.ChannelID)
+		if h.isHubOf(book) {
+			return reject(errHubTrade)
+		}
+		ack, fills := book.CreateOrder(order, orderbook.Admission{
+			Balance:  balance,
+			Signer:   signer,
+			Trader:   signer,
+			Decimals: decimals,
+		})
+		canceled := new(big.Rat)
+		if ack.Canceled != "" {
+			canceled.SetString(ack.Canceled)
+		}
+		if order.TimeInForce == message.TimeFOK && len(fills) > 0 {
+			trades, err := h.settleFillOrKill(ch, book, fills)
+			if err != nil {
+				h.log("settling fill-or-kill order ", ack.ID, ": ", err)
+				return &message.CreateOrderAck{
+					ID:        ack.ID,
+					ClientTag: ack.ClientTag,
+					Accepted:  false,
+					Reason:    err.Error(),
+					TotalOpen: ack.TotalOpen,
+				}, true
+			}
+			ack.Trades = trades
+			fills = nil
+		}
+		for _, f := range fills {
+			trade, err := h.settleFill(ch, book, f)
+			if err != nil {
+				h.log("settling fill of order ", f.Maker.ID, ": ", err)
+				ack.Reason = err.Error()
+				if trade.Unbalanced {
+					ack.Trades = append(ack.Trades, trade)
+				}
+				if f.Canceled != nil {
+					canceled.Add(canceled, f.Canceled)
+				}
+				continue
+			}
+			ack.Trades = append(ack.Trades, trade)
+		}
+		if canceled.Sign() > 0 {
+			ack.Canceled = orderbook.FormatDecimal(canceled)
+		}
+		// An order none of whose fills settled and that does not rest in
+		// the book was not executed at all.
+		if len(fills) > 0 && len(ack.Trades) == 0 {
+			if _, ok := book.Order(ack.ID); !ok {
+				ack.Accepted = false
+			}
+		}
+		ack.Fee = totalFee(ack.Trades)
 		return &ack, true
 
 	case *message.CancelOrder:
+		ch, chOk := h.getChannel(m.ChannelID)
 		book, ok := OrderBookEngine.GetBook(m.ChannelID)
-		if !ok {
+		if !ok || !chOk {
 			return &message.CancelOrderAck{
 				ID:      m.ID,
 				Success: false,
 				Reason:  "channel not found",
 			}, true
 		}
-		ack := book.CancelOrder(m.ID)
+		ack := book.CancelOrder(m.ID, ch.ID(), ch.Idx())
 		return &ack, true
 
-	case *message.AcceptOrder:
+	case *message.ReplaceOrder:
+		reject := func(reason string) (message.Message, bool) {
+			return &message.ReplaceOrderAck{
+				ID:      m.ID,
+				Success: false,
+				Reason:  reason,
+			}, true
+		}
+		ch, chOk := h.getChannel(m.ChannelID)
 		book, ok := OrderBookEngine.GetBook(m.ChannelID)
+		if !ok || !chOk {
+			return reject("channel not found")
+		}
+		order, ok := book.Order(m.ID)
 		if !ok {
+			return reject("order not found")
+		}
+		if m.Price != "" {
+			order.Price = m.Price
+		}
+		if m.Amount != "" {
+			order.Amount = m.Amount
+		}
+		// The replacement is signed like a new order; the book checks that
+		// it is still the maker's and only differs in price and amount.
+		if err := h.signOrder(&order); err != nil {
+			return reject(err.Error())
+		}
+		signer, err := participantL2Address(ch, ch.Idx())
+		if err != nil {
+			return reject(err.Error())
+		}
+		balance, err := h.orderBalance(ch, order)
+		if err != nil {
+			return reject(err.Error())
+		}
+		decimals, err := h.marketDecimals(order)
+		if err != nil {
+			return reject(err.Error())
+		}
+		ack := book.ReplaceOrder(order, ch.ID(), ch.Idx(), orderbook.Admission{
+			Balance:  balance,
+			Signer:   signer,
+			Decimals: decimals,
+		})
+		return &ack, true
+
+	case *message.AcceptOrder:
+		ch, chOk := h.getChannel(m.ChannelID)
+		book, ok := OrderBookEngine.GetBook(m.ChannelID)
+		if !ok || !chOk {
 			return &message.AcceptOrderAck{
 				ID:       m.ID,
 				Accepted: false,
 				Reason:   "channel not found",
 			}, true
 		}
-		ack := book.AcceptOrder(m.ID)
+		if h.isHubOf(book) {
+			return &message.AcceptOrderAck{
+				ID:       m.ID,
+				Accepted: false,
+				Reason:   errHubTrade.Error(),
+			}, true
+		}
+		trader, err := participantL2Address(ch, ch.Idx())
+		if err != nil {
+			return &message.AcceptOrderAck{
+				ID:       m.ID,
+				Accepted: false,
+				Reason:   err.Error(),
+			}, true
+		}
+		ack, fill := book.AcceptOrder(m.ID, m.Amount, ch.ID(), ch.Idx(), trader)
+		if fill == nil {
+			return &ack, true
+		}
+		trade, err := h.settleFill(ch, book, fill)
+		if err != nil && trade.Unbalanced {
+			// The taker's side was settled, the maker's was not.
+			ack.Reason = err.Error()
+			ack.Trade = &trade
+			ack.Fee = trade.TakerFee
+			return &ack, true
+		} else if err != nil {
+			return &message.AcceptOrderAck{
+				ID:       m.ID,
+				Accepted: false,
+				Reason:   err.Error(),
+			}, true
+		}
+		ack.Trade = &trade
+		ack.Fee = trade.TakerFee
 		return &ack, true
 
 	case *message.GetOrderBook:
+		if _, ok := h.getChannel(m.ChannelID); !ok {
+			return &message.Error{Err: "channel not found"}, true
+		}
 		book, ok := OrderBookEngine.GetBook(m.ChannelID)
 		if !ok {
 			empty := message.OrderBookSnapshot{
@@ -50,9 +236,185 @@ func (h *requestHandler) HandleOrderBookMessage(msg message.Message) (message.Me
 			}
 			return &message.GetOrderBookResponse{Snapshot: &empty}, true
 		}
+		if m.SinceSequence > 0 {
+			if delta, ok := book.DeltaSince(m.SinceSequence); ok {
+				return &message.GetOrderBookResponse{Delta: &delta}, true
+			}
+		}
 		snap := book.Snapshot()
 		return &message.GetOrderBookResponse{Snapshot: &snap}, true
+
+	case *message.GetDepth:
+		if _, ok := h.getChannel(m.ChannelID); !ok {
+			return &message.Error{Err: "channel not found"}, true
+		}
+		book, ok := OrderBookEngine.GetBook(m.ChannelID)
+		if !ok {
+			return &message.GetDepthResponse{Depth: message.OrderBookDepth{
+				ChannelID: m.ChannelID,
+				Markets:   []message.MarketDepth{},
+			}}, true
+		}
+		return &message.GetDepthResponse{Depth: book.Depth(m.Levels, m.Market)}, true
+
+	case *message.GetTrades:
+		if _, ok := h.getChannel(m.ChannelID); !ok {
+			return &message.Error{Err: "channel not found"}, true
+		}
+		book, ok := OrderBookEngine.GetBook(m.ChannelID)
+		if !ok {
+			return &message.GetTradesResponse{Trades: []message.Trade{}}, true
+		}
+		trades, more := book.Trades(orderbook.TradeQuery{
+			Market:        m.Market,
+			From:          m.From,
+			To:            m.To,
+			AfterSequence: m.AfterSequence,
+			Limit:         m.Limit,
+		})
+		return &message.GetTradesResponse{Trades: trades, More: more}, true
+
+	case *message.GetCandles:
+		if _, ok := h.getChannel(m.ChannelID); !ok {
+			return &message.Error{Err: "channel not found"}, true
+		}
+		book, ok := OrderBookEngine.GetBook(m.ChannelID)
+		if !ok {
+			return &message.GetCandlesResponse{Candles: []message.Candle{}}, true
+		}
+		candles, err := book.Candles(m.Market, m.Interval, m.From, m.To, m.Limit)
+		if err != nil {
+			return &message.Error{Err: err.Error()}, true
+		}
+		return &message.GetCandlesResponse{Candles: candles}, true
+
+	case *message.EnableConsolidatedBook:
+		hub := h.l2Address()
+		book := OrderBookEngine.EnableHub(hub)
+		resp := &message.ConsolidatedBookEnabled{
+			BookID:   orderbook.HubBookID(hub),
+			Channels: []channel.ID{},
+		}
+		for _, ch := range h.allChannels() {
+			if OrderBookEngine.RouteChannel(ch.ID(), hub) {
+				resp.Channels = append(resp.Channels, ch.ID())
+			}
+		}
+		h.log("order book ", book.Hub(), ": consolidated book enabled for ", len(resp.Channels), " channels")
+		return resp, true
+
+	case *message.SetAuctionMode:
+		ack := &message.SetAuctionModeAck{ChannelID: m.ChannelID, Interval: m.Interval}
+		book, err := h.ownBook(m.ChannelID)
+		if err != nil {
+			ack.Reason = err.Error()
+			return ack, true
+		}
+		fills, reason := book.SetAuctionInterval(m.Interval)
+		if reason != "" {
+			ack.Reason = reason
+			return ack, true
+		}
+		ack.Success = true
+		// The orders collected for the next auction are cleared right away
+		// when switching back to continuous matching.
+		ch, _ := h.getChannel(m.ChannelID)
+		for _, f := range fills {
+			trade, err := h.settleFill(ch, book, f)
+			if err != nil {
+				h.log("settling auction fill of order ", f.Maker.ID, ": ", err)
+				if !trade.Unbalanced {
+					continue
+				}
+			}
+			ack.Trades = append(ack.Trades, trade)
+		}
+		return ack, true
+
+	case *message.GetStreamToken:
+		token, expires, err := h.reg.IssueStreamToken(h.Client)
+		if err != nil {
+			return &message.Error{Err: err.Error()}, true
+		}
+		return &message.StreamToken{Token: token, ExpiresAt: expires.Unix()}, true
+
+	case *message.SetOrderBookVisibility:
+		ack := &message.SetOrderBookVisibilityAck{ChannelID: m.ChannelID, Public: m.Public}
+		book, err := h.ownBook(m.ChannelID)
+		if err != nil {
+			ack.Reason = err.Error()
+			return ack, true
+		}
+		if ch, ok := h.getChannel(m.ChannelID); ok && !mayChangeVisibility(book, ch.Idx()) {
+			ack.Reason = "only the proposer of the channel can change the visibility"
+			return ack, true
+		}
+		book.SetPublic(m.Public)
+		ack.Success = true
+		return ack, true
+
+	case *message.SetCancelOnDisconnect:
+		return h.setCancelOnDisconnect(m), true
 	}
 
 	return nil, false
 }
+
+// CanStream reports whether the client may stream the book of the channel:
+// it participates in the channel, it is the hub of the book or the book is
+// public.
+func (c *Client) CanStream(chID channel.ID) bool {
+	if _, ok := c.getChannel(chID); ok {
+		return true
+	}
+	book, ok := OrderBookEngine.GetBook(chID)
+	return ok && (c.isHubOf(book) || book.Public())
+}
+
+// ownBook returns the book of the channel if the client may change its
+// settings. These are the participants of the channel, and for a consolidated
+// book only its hub, as it holds the orders of all the hub's channels.
+func (c *Client) ownBook(chID channel.ID) (*orderbook.Book, error) {
+	if _, ok := c.getChannel(chID); ok {
+		book := OrderBookEngine.GetOrCreateBook(chID)
+		if book.Hub() != nil && !c.isHubOf(book) {
+			return nil, errors.New("only the hub can change the consolidated book")
+		}
+		return book, nil
+	}
+	if book, ok := OrderBookEngine.GetBook(chID); ok && c.isHubOf(book) {
+		return book, nil
+	}
+	return nil, errors.New("channel not found")
+}
+
+// mayChangeVisibility reports whether the participant at idx of the channel
+// may change the visibility of the book that ownBook returned for it. The
+// book of a single channel is owned by the participant that proposed the
+// channel, so that its peer cannot publish it alone. ownBook only returns a
+// consolidated book to its hub.
+func mayChangeVisibility(book *orderbook.Book, idx channel.Index) bool {
+	return book.Hub() != nil || idx == client.ProposerIdx
+}
+
+// l2Address returns the client's L2 address as a wallet address.
+func (c *Client) l2Address() wallet.Address {
+	return ethwallet.AsWalletAddr(c.addr)
+}
+
+// isHubOf reports whether the client is the hub of the consolidated book.
+func (c *Client) isHubOf(book *orderbook.Book) bool {
+	hub := book.Hub()
+	return hub != nil && hub.Equal(c.l2Address())
+}
+
+// routeOrderBook sends the orders of a new channel to the consolidated book
+// of its peer if the peer is a hub in consolidated mode, or to the client's
+// own consolidated book.
+func (c *Client) routeOrderBook(ch *client.Channel) {
+	for _, part := range ch.Params().Parts {
+		if addr, ok := part[message.EthereumIndex]; ok && OrderBookEngine.RouteChannel(ch.ID(), addr) {
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	ethwallet "github.com/perun-network/perun-eth-backend/wallet"
+	"perun.network/go-perun/channel"
+)
+
+func TestSetOrderBookVisibility(t *testing.T) {
+	e := useEngine(t)
+	hub := common.Address{1}
+	book := e.EnableHub(ethwallet.AsWalletAddr(hub))
+	chID := channel.ID{2}
+	if !e.RouteChannel(chID, ethwallet.AsWalletAddr(hub)) {
+		t.Fatal("channel not routed")
+	}
+
+	tests := []struct {
+		name   string
+		client common.Address
+		reason string
+	}{
+		{name: "hub", client: hub},
+		{name: "other client", client: common.Address{3}, reason: "channel not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &requestHandler{&Client{addr: tt.client}}
+			resp, ok := h.HandleOrderBookMessage(&message.SetOrderBookVisibility{ChannelID: chID, Public: true})
+			if !ok {
+				t.Fatal("message not handled")
+			}
+			ack := resp.(*message.SetOrderBookVisibilityAck)
+			if ack.Success != (tt.reason == "") || ack.Reason != tt.reason {
+				t.Errorf("success %t with reason %q, want %q", ack.Success, ack.Reason, tt.reason)
+			}
+			if book.Public() != (tt.reason == "") {
+				t.Errorf("book public %t", book.Public())
+			}
+			book.SetPublic(false)
+		})
+	}
+}
+
+func TestMayChangeVisibility(t *testing.T) {
+	e := useEngine(t)
+	book := e.GetOrCreateBook(channel.ID{1})
+	if !mayChangeVisibility(book, 0) {
+		t.Error("proposer refused")
+	}
+	if mayChangeVisibility(book, 1) {
+		t.Error("peer of the proposer allowed")
+	}
+
+	// A consolidated book is only returned to its hub, which may change it
+	// in every routed channel.
+	hub := ethwallet.AsWalletAddr(common.Address{1})
+	hubBook := e.EnableHub(hub)
+	e.RouteChannel(channel.ID{2}, hub)
+	if !mayChangeVisibility(hubBook, 1) {
+		t.Error("hub refused")
+	}
+}
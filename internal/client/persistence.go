@@ -0,0 +1,203 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel/persistence/keyvalue"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/log"
+	"polycry.pt/poly-go/sortedkv/leveldb"
+)
+
+// keysDir is the directory below the channel directory that holds the L2 keys
+// of the clients, so that a returning client keeps its L2 identity.
+const keysDir = "keys"
+
+// identity is the persisted L2 key of a client together with its L1
+// addresses.
+type identity struct {
+	EthAddress common.Address `json:"ethAddress"`
+	SolAddress string         `json:"solAddress"`
+	// Key is the hex encoded L2 private key.
+	Key string `json:"key"`
+}
+
+// l2Key returns the L2 key of the client with the given L1 addresses. If
+// channels are persisted in dir, the key is stored there on first use and
+// loaded on every later registration; otherwise a new key is generated.
+func l2Key(dir string, eaddr common.Address, saddr string) (*ecdsa.PrivateKey, error) {
+	if dir == "" {
+		return ecdsa.GenerateKey(secp256k1.S256(), rand.Reader)
+	}
+
+	path := keyFile(dir, eaddr, saddr)
+	id, err := readIdentity(path)
+	if err == nil {
+		return crypto.HexToECDSA(id.Key)
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("loading L2 key: %w", err)
+	}
+
+	sk, err := ecdsa.GenerateKey(secp256k1.S256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id = identity{
+		EthAddress: eaddr,
+		SolAddress: saddr,
+		Key:        hex.EncodeToString(crypto.FromECDSA(sk)),
+	}
+	if err := writeIdentity(path, id); err != nil {
+		return nil, fmt.Errorf("storing L2 key: %w", err)
+	}
+	return sk, nil
+}
+
+// readIdentity reads the identity stored in the file.
+func readIdentity(path string) (identity, error) {
+	var id identity
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return id, err
+	}
+	return id, json.Unmarshal(data, &id)
+}
+
+// writeIdentity atomically stores the identity in the file, which is only
+// readable by the server.
+func writeIdentity(path string, id identity) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(id)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadIdentities reads all identities stored in dir.
+func loadIdentities(dir string) ([]identity, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, keysDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ids []identity
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) == ".tmp" {
+			continue
+		}
+		id, err := readIdentity(filepath.Join(dir, keysDir, entry.Name()))
+		if err != nil {
+			log.Warnf("skipping unreadable L2 key %s: %v", entry.Name(), err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// keyFile returns the file that holds the L2 key of the client with the given
+// L1 addresses. It is named after their hash, so that the addresses sent by
+// the client never become part of the path.
+func keyFile(dir string, eaddr common.Address, saddr string) string {
+	h := crypto.Keccak256(eaddr.Bytes(), []byte(saddr))
+	return filepath.Join(dir, keysDir, hex.EncodeToString(h))
+}
+
+// openPersistRestorer opens the channel database of the L2 identity in dir.
+func openPersistRestorer(dir string, l2 common.Address) (*keyvalue.PersistRestorer, error) {
+	db, err := leveldb.LoadDatabase(filepath.Join(dir, l2.Hex()))
+	if err != nil {
+		return nil, fmt.Errorf("opening channel database: %w", err)
+	}
+	return keyvalue.NewPersistRestorer(db), nil
+}
+
+// restoreChannels restores the persisted channels of the client and watches
+// them again. It must be called before the client handles proposals, as every
+// channel added to the Perun client meanwhile is treated as restored.
+func (c *Client) restoreChannels() ([]message.RestoredChannel, error) {
+	if c.persister == nil {
+		return nil, nil
+	}
+
+	// The channels of different peers are restored concurrently.
+	var (
+		mu       sync.Mutex
+		restored []message.RestoredChannel
+	)
+	c.perunClient.OnNewChannel(func(ch *client.Channel) {
+		c.log(fmt.Sprintf("Channel restored %x", ch.ID()))
+		c.addChannel(ch)
+		c.watchChannel(ch)
+		if ch.State().IsFinal {
+			OrderBookEngine.FinalizeChannel(ch.ID())
+		}
+		mu.Lock()
+		restored = append(restored, message.RestoredChannel{ID: ch.ID(), Idx: ch.Idx()})
+		mu.Unlock()
+	})
+	defer c.perunClient.OnNewChannel(func(*client.Channel) {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeouts.DefaultTimeout)
+	defer cancel()
+	err := c.perunClient.Restore(ctx)
+	mu.Lock()
+	defer mu.Unlock()
+	return restored, err
+}
+
+// RestoreChannels restores the persisted channels of all L2 identities in the
+// channel directory and watches them until their users reconnect, so that
+// disputes raised while the server was down are answered. The restored clients
+// have no connection and cannot sign for their users.
+func (r *Registry) RestoreChannels(cfg Config) error {
+	ids, err := loadIdentities(cfg.ChannelDir)
+	if err != nil {
+		return fmt.Errorf("loading L2 keys: %w", err)
+	}
+	for _, id := range ids {
+		sk, err := crypto.HexToECDSA(id.Key)
+		if err != nil {
+			log.Warnf("skipping invalid L2 key of %s: %v", id.SolAddress, err)
+			continue
+		}
+		c, err := NewClient(message.NewDetachedConnection(), sk, id.EthAddress, id.SolAddress, cfg, r)
+		if err != nil {
+			log.Warnf("creating client of %s: %v", id.SolAddress, err)
+			continue
+		}
+		restored, err := c.restoreChannels()
+		if err != nil {
+			c.log("restoring channels: ", err)
+		}
+		if len(restored) == 0 {
+			c.shutdown()
+			continue
+		}
+		r.mtx.Lock()
+		r.detached[c.addr] = c
+		r.mtx.Unlock()
+	}
+	return nil
+}
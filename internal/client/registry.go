@@ -1,24 +1,41 @@
 package client
 
 import (
-	"crypto/ecdsa"
 	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/crypto/secp256k1"
 
 	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
 )
 
+// StreamTokenTTL is the time a stream token can be used to open order book
+// streams.
+const StreamTokenTTL = time.Hour
+
 // Registry is a registry of clients.
 type Registry struct {
 	m           map[string]*Client
 	l2Addresses map[string]common.Address
-	mtx         sync.RWMutex
+	// tokens are the issued stream tokens.
+	tokens map[string]streamToken
+	// detached are the clients restored at startup whose users have not
+	// reconnected yet, by L2 address.
+	detached map[common.Address]*Client
+	mtx      sync.RWMutex
+}
+
+// streamToken authenticates a client on the order book stream.
+type streamToken struct {
+	client  *Client
+	expires time.Time
 }
 
 // NewRegistry creates a new registry.
@@ -26,16 +43,25 @@ func NewRegistry() *Registry {
 	return &Registry{
 		m:           make(map[string]*Client),
 		l2Addresses: make(map[string]common.Address),
+		tokens:      make(map[string]streamToken),
+		detached:    make(map[common.Address]*Client),
 		mtx:         sync.RWMutex{},
 	}
 }
 
 // Register creates and registers a new client at the given address. Fails if
-// another client is already registered at the specified address.
+// another client is already registered at the specified address. If channels
+// are persisted, the client must prove that it controls its L1 addresses, and
+// a returning client gets its previous L2 key and its channels are restored.
 func (r *Registry) Register(eaddr common.Address, saddr string, conn *message.Connection, cfg Config) (*Client, error) {
-	sk, err := ecdsa.GenerateKey(secp256k1.S256(), rand.Reader)
+	if cfg.ChannelDir != "" {
+		if err := proveOwnership(conn, eaddr, saddr); err != nil {
+			return nil, fmt.Errorf("proving address ownership: %w", err)
+		}
+	}
+	sk, err := l2Key(cfg.ChannelDir, eaddr, saddr)
 	if err != nil {
-		return nil, fmt.Errorf("cannot generate private key: %w", err)
+		return nil, fmt.Errorf("cannot get private key: %w", err)
 	}
 	publicKey := sk.PublicKey
 
@@ -56,6 +82,11 @@ func (r *Registry) Register(eaddr common.Address, saddr string, conn *message.Co
 	if _, ok := r.l2Addresses[saddr]; ok && saddr != "" {
 		return nil, fmt.Errorf("client with same solana address already registered")
 	}
+	// The detached client holds the channel database of the L2 identity.
+	if c, ok := r.detached[address]; ok {
+		delete(r.detached, address)
+		c.shutdown()
+	}
 
 	c, err := NewClient(conn, sk, eaddr, saddr, cfg, r)
 	if err != nil {
@@ -76,6 +107,12 @@ func (r *Registry) Remove(a string) {
 	l2, _ := r.getL2Address(a)
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
+	for _, key := range []string{a, l2.String()} {
+		if c, ok := r.m[key]; ok {
+			r.revokeStreamTokens(c)
+			r.cancelOnDisconnect(c)
+		}
+	}
 	delete(r.l2Addresses, a)
 	delete(r.m, a)
 	delete(r.m, l2.String())
@@ -100,3 +137,59 @@ func (r *Registry) getL2Address(a string) (common.Address, bool) {
 	c, ok := r.l2Addresses[a]
 	return c, ok
 }
+
+// IssueStreamToken issues a token with which the client can open order book
+// streams until the token expires or the client is removed.
+func (r *Registry) IssueStreamToken(c *Client) (string, time.Time, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", time.Time{}, fmt.Errorf("cannot generate stream token: %w", err)
+	}
+	token := hex.EncodeToString(b[:])
+	expires := time.Now().Add(StreamTokenTTL)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for t, st := range r.tokens {
+		if time.Now().After(st.expires) {
+			delete(r.tokens, t)
+		}
+	}
+	r.tokens[token] = streamToken{client: c, expires: expires}
+	return token, expires, nil
+}
+
+// Authenticate returns the client the stream token was issued to if the
+// token is valid.
+func (r *Registry) Authenticate(token string) (*Client, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	st, ok := r.tokens[token]
+	if !ok || time.Now().After(st.expires) {
+		return nil, false
+	}
+	return st.client, true
+}
+
+// revokeStreamTokens invalidates all stream tokens of the client. Must be
+// called with r.mtx held.
+func (r *Registry) revokeStreamTokens(c *Client) {
+	for t, st := range r.tokens {
+		if st.client == c {
+			delete(r.tokens, t)
+		}
+	}
+}
+
+// participant returns a registered client that participates in the channel
+// and its channel object.
+func (r *Registry) participant(chID channel.ID) (*Client, *client.Channel, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	for _, c := range r.m {
+		if ch, ok := c.getChannel(chID); ok {
+			return c, ch, true
+		}
+	}
+	return nil, nil, false
+}
@@ -180,6 +180,17 @@ func (c *Client) handleGetDecimals(msg *message.GetDecimals) message.Message {
 	return &message.Error{Err: "Asset not found"}
 }
 
+// assetDecimals returns the decimals of a Solana or Ethereum asset.
+func (c *Client) assetDecimals(asset message.Asset) (uint8, error) {
+	switch a := asset.(type) {
+	case *message.SolanaAsset:
+		return c.getSolanaAssetDecimals(*a)
+	case *message.EthereumAsset:
+		return c.getEthereumAssetDecimals(*a)
+	}
+	return 0, errors.Errorf("unknown asset type %T", asset)
+}
+
 func (c *Client) getSolanaAssetDecimals(asset message.SolanaAsset) (uint8, error) {
 	return 9, nil
 }
@@ -0,0 +1,506 @@
+package client
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"github.com/perun-network/perun-dex-websocket/internal/orderbook"
+	wwallet "github.com/perun-network/perun-dex-websocket/internal/wallet"
+	ethwallet "github.com/perun-network/perun-eth-backend/wallet"
+	"github.com/pkg/errors"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/client"
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/wallet"
+)
+
+// transfer describes the balance movement of a single trade in a two party
+// channel: the seller sends baseAmt of the base asset to the buyer, who pays
+// quoteAmt of the quote asset in return. If fee is set, feePayer pays it to
+// feePayee in the asset at feeIdx.
+type transfer struct {
+	baseIdx, quoteIdx  int
+	buyer, seller      channel.Index
+	baseAmt, quoteAmt  *big.Int
+	dec                orderbook.Decimals
+	feeIdx             int
+	feePayer, feePayee channel.Index
+	fee                *big.Int
+}
+
+// settleFill executes the fill as a channel update in which the client is the
+// taker. The fill is committed in the book once the peer accepted the update
+// and aborted otherwise. Fills of a consolidated book are settled through the
+// hub instead.
+func (c *Client) settleFill(ch *client.Channel, book *orderbook.Book, f *orderbook.Fill) (message.Trade, error) {
+	if hub := book.Hub(); hub != nil {
+		return c.settleHubFill(hub, book, f)
+	}
+
+	// The taker checks the maker's commitment independently of the book.
+	if err := c.verifyMaker(ch, f.Maker); err != nil {
+		book.AbortFill(f)
+		return message.Trade{}, err
+	}
+	t, err := c.makeTransfer(ch, f.Maker, f.Price, f.Amount, f.Maker.MakerIdx, f.TakerIdx)
+	if err != nil {
+		book.AbortFill(f)
+		return message.Trade{}, err
+	}
+
+	s := c.chargeHubFee(ch, f, t)
+
+	// Both sides of a trade between orders of the same participant are in
+	// the same hands, so there is nothing to settle.
+	if t.buyer != t.seller {
+		if err := c.updateChannel(ch, t.apply); err != nil {
+			book.AbortFill(f)
+			return message.Trade{}, errors.WithMessage(err, "settling fill")
+		}
+	}
+	s.Version = ch.State().Version
+	trade, triggered := book.CommitFill(f, s)
+	c.settleTriggered(ch, book, triggered)
+	return trade, nil
+}
+
+// settleFillOrKill executes the fills of a fill-or-kill order in which the
+// client is the taker as a single channel update, so that they are committed
+// or aborted together.
+func (c *Client) settleFillOrKill(ch *client.Channel, book *orderbook.Book, fills []*orderbook.Fill) ([]message.Trade, error) {
+	abort := func(err error) ([]message.Trade, error) {
+		for _, f := range fills {
+			book.AbortFill(f)
+		}
+		return nil, err
+	}
+
+	// Each fill's balances are checked after the transfers of the previous
+	// ones.
+	state := ch.State().Clone()
+	transfers := make([]*transfer, 0, len(fills))
+	settlements := make([]orderbook.Settlement, len(fills))
+	for i, f := range fills {
+		if err := c.verifyMaker(ch, f.Maker); err != nil {
+			return abort(err)
+		}
+		t, err := c.transferIn(state, f.Maker, f.Price, f.Amount, f.Maker.MakerIdx, f.TakerIdx)
+		if err != nil {
+			return abort(err)
+		}
+		settlements[i] = c.chargeHubFee(ch, f, t)
+		if t.buyer != t.seller {
+			t.apply(state)
+			transfers = append(transfers, t)
+		}
+	}
+	if len(transfers) > 0 {
+		err := c.updateChannel(ch, func(s *channel.State) {
+			for _, t := range transfers {
+				t.apply(s)
+			}
+		})
+		if err != nil {
+			return abort(errors.WithMessage(err, "settling fill-or-kill order"))
+		}
+	}
+
+	version := ch.State().Version
+	trades := make([]message.Trade, 0, len(fills))
+	var triggered []*orderbook.Fill
+	for i, f := range fills {
+		settlements[i].Version = version
+		trade, t := book.CommitFill(f, settlements[i])
+		trades = append(trades, trade)
+		triggered = append(triggered, t...)
+	}
+	c.settleTriggered(ch, book, triggered)
+	return trades, nil
+}
+
+// chargeHubFee charges the fee of the party that trades with the hub if one
+// participant of the channel is a hub in consolidated mode. It returns the
+// settlement with the fee; fills in other channels are free.
+func (c *Client) chargeHubFee(ch *client.Channel, f *orderbook.Fill, t *transfer) orderbook.Settlement {
+	hub, ok := channelHub(ch)
+	if !ok {
+		return orderbook.Settlement{}
+	}
+	return c.hubFee(hub, f, t)
+}
+
+// hubFee charges the fee of the party that trades with the hub at index hub
+// in the transfer of the fill and returns the settlement with the fee.
+func (c *Client) hubFee(hub channel.Index, f *orderbook.Fill, t *transfer) orderbook.Settlement {
+	var s orderbook.Settlement
+	if t.buyer == t.seller {
+		return s
+	}
+	switch hub {
+	case f.Maker.MakerIdx:
+		rates := c.fees.Rates(f.Maker, receivedAsset(f.Maker, f.TakerSide))
+		s.TakerFee = t.chargeFee(f.TakerIdx, hub, rates.Taker)
+	case f.TakerIdx:
+		rates := c.fees.Rates(f.Maker, receivedAsset(f.Maker, f.Maker.Side))
+		s.MakerFee = t.chargeFee(f.Maker.MakerIdx, hub, rates.Maker)
+	}
+	return s
+}
+
+// channelHub returns the index of the participant of the channel that is a
+// hub in consolidated mode, if any.
+func channelHub(ch *client.Channel) (channel.Index, bool) {
+	for i, part := range ch.Params().Parts {
+		addr, ok := part[message.EthereumIndex]
+		if !ok {
+			continue
+		}
+		if _, ok := OrderBookEngine.HubBook(addr); ok {
+			return channel.Index(i), true
+		}
+	}
+	return 0, false
+}
+
+// settleHubFill executes a fill of a hub's consolidated book as two channel
+// updates proposed by the hub: the hub takes the maker's side against the
+// taker in the taker's channel, then the taker's side against the maker in
+// the maker's channel. If the maker's channel rejects the update, the hub
+// proposes to undo the taker's update. If that fails as well, the fill is
+// recorded as an unbalanced trade, which is returned along with the error.
+func (c *Client) settleHubFill(hubAddr wallet.Address, book *orderbook.Book, f *orderbook.Fill) (message.Trade, error) {
+	abort := func(err error) (message.Trade, error) {
+		book.AbortFill(f)
+		return message.Trade{}, err
+	}
+	hub, ok := c.reg.Get(hubAddr.String())
+	if !ok {
+		return abort(errors.New("hub not connected"))
+	}
+	makerCh, ok := hub.getChannel(f.Maker.ChannelID)
+	if !ok {
+		return abort(errors.Errorf("maker channel %x not found", f.Maker.ChannelID))
+	}
+	takerCh, ok := hub.getChannel(f.TakerChannel)
+	if !ok {
+		return abort(errors.Errorf("taker channel %x not found", f.TakerChannel))
+	}
+	if err := c.verifyMaker(makerCh, f.Maker); err != nil {
+		return abort(err)
+	}
+	takerLeg, err := c.makeTransfer(takerCh, f.Maker, f.Price, f.Amount, takerCh.Idx(), f.TakerIdx)
+	if err != nil {
+		return abort(errors.WithMessage(err, "taker channel"))
+	}
+	makerLeg, err := c.makeTransfer(makerCh, f.Maker, f.Price, f.Amount, f.Maker.MakerIdx, makerCh.Idx())
+	if err != nil {
+		return abort(errors.WithMessage(err, "maker channel"))
+	}
+
+	// The hub charges each party its fee in the party's own channel.
+	var s orderbook.Settlement
+	if f.TakerChannel != f.Maker.ChannelID {
+		takerRates := c.fees.Rates(f.Maker, receivedAsset(f.Maker, f.TakerSide))
+		s.TakerFee = takerLeg.chargeFee(f.TakerIdx, takerCh.Idx(), takerRates.Taker)
+		makerRates := c.fees.Rates(f.Maker, receivedAsset(f.Maker, f.Maker.Side))
+		s.MakerFee = makerLeg.chargeFee(f.Maker.MakerIdx, makerCh.Idx(), makerRates.Maker)
+	}
+
+	// Both orders of a trader trade in the same channel with the hub, where
+	// both legs cancel out.
+	if f.TakerChannel != f.Maker.ChannelID {
+		if err := hub.updateChannel(takerCh, takerLeg.apply); err != nil {
+			return abort(errors.WithMessage(err, "settling fill in taker channel"))
+		}
+		if err := hub.updateChannel(makerCh, makerLeg.apply); err != nil {
+			if rErr := hub.updateChannel(takerCh, takerLeg.reverse().apply); rErr != nil {
+				hub.log("undoing taker side of fill of order ", f.Maker.ID, ": ", rErr)
+				s.Version, s.MakerFee = makerCh.State().Version, nil
+				s.TakerVersion = takerCh.State().Version
+				trade := book.CommitTakerLeg(f, s)
+				return trade, errors.Errorf("settling fill in maker channel: %v; undoing taker side: %v", err, rErr)
+			}
+			return abort(errors.WithMessage(err, "settling fill in maker channel"))
+		}
+	}
+	s.Version = makerCh.State().Version
+	s.TakerVersion = takerCh.State().Version
+	trade, triggered := book.CommitFill(f, s)
+	c.settleTriggered(nil, book, triggered)
+	return trade, nil
+}
+
+// settleTriggered settles the fills of stop orders that were released by a
+// trade. They are executed by the client that made the triggering trade on
+// behalf of the stop order's maker.
+func (c *Client) settleTriggered(ch *client.Channel, book *orderbook.Book, fills []*orderbook.Fill) {
+	fok := make(map[message.OrderID][]*orderbook.Fill)
+	for _, f := range fills {
+		if f.AllOrNone() {
+			fok[f.TakerOrderID] = append(fok[f.TakerOrderID], f)
+			continue
+		}
+		if _, err := c.settleFill(ch, book, f); err != nil {
+			c.log("settling triggered fill of order ", f.Maker.ID, ": ", err)
+		}
+	}
+	for id, fs := range fok {
+		if _, err := c.settleFillOrKill(ch, book, fs); err != nil {
+			c.log("settling triggered fill-or-kill order ", id, ": ", err)
+		}
+	}
+}
+
+// signOrder signs the order with the client's L2 key under a fresh nonce.
+func (c *Client) signOrder(o *message.Order) error {
+	o.Nonce = c.nextOrderNonce()
+	data, err := o.SigningData()
+	if err != nil {
+		return err
+	}
+	acc := wwallet.GetAccount(ethwallet.AsWalletAddr(c.addr))
+	if acc == nil {
+		return errors.New("L2 account not found")
+	}
+	sig, err := acc.SignData(data)
+	if err != nil {
+		return errors.WithMessage(err, "signing order")
+	}
+	o.Signature = sig
+	return nil
+}
+
+// nextOrderNonce returns a nonce greater than all previous ones. Nonces start
+// at the current time so that they keep increasing across restarts.
+func (c *Client) nextOrderNonce() uint64 {
+	for {
+		last := c.orderNonce.Load()
+		next := uint64(time.Now().UnixNano())
+		if next <= last {
+			next = last + 1
+		}
+		if c.orderNonce.CompareAndSwap(last, next) {
+			return next
+		}
+	}
+}
+
+// participantL2Address returns the L2 address of the channel participant at
+// idx that orders of this participant are signed with.
+func participantL2Address(ch *client.Channel, idx channel.Index) (wallet.Address, error) {
+	parts := ch.Params().Parts
+	if int(idx) >= len(parts) {
+		return nil, errors.Errorf("invalid participant index %d", idx)
+	}
+	addr, ok := parts[idx][message.EthereumIndex]
+	if !ok {
+		return nil, errors.Errorf("participant %d has no L2 address", idx)
+	}
+	return addr, nil
+}
+
+// verifyMaker checks the signature of the maker order against the maker's L2
+// address in the channel.
+func (c *Client) verifyMaker(ch *client.Channel, o message.Order) error {
+	signer, err := participantL2Address(ch, o.MakerIdx)
+	if err != nil {
+		return err
+	}
+	return errors.WithMessage(orderbook.VerifyOrder(o, signer), "maker order")
+}
+
+// makeTransfer computes the balance movement of filling amount of the maker
+// order at price between the participants at makerIdx and takerIdx of the
+// channel from the order's side and the decimals of the base and quote
+// assets, rounded as described at orderbook.FillUnits.
+func (c *Client) makeTransfer(ch *client.Channel, maker message.Order, price string, amount *big.Rat, makerIdx, takerIdx channel.Index) (*transfer, error) {
+	return c.transferIn(ch.State(), maker, price, amount, makerIdx, takerIdx)
+}
+
+// transferIn is makeTransfer against the given channel state.
+func (c *Client) transferIn(state *channel.State, maker message.Order, price string, amount *big.Rat, makerIdx, takerIdx channel.Index) (*transfer, error) {
+	if int(makerIdx) >= state.NumParts() {
+		return nil, errors.Errorf("invalid maker index %d", makerIdx)
+	}
+	if int(takerIdx) >= state.NumParts() {
+		return nil, errors.Errorf("invalid taker index %d", takerIdx)
+	}
+
+	baseIdx, err := assetIndex(state, maker.Base)
+	if err != nil {
+		return nil, err
+	}
+	quoteIdx, err := assetIndex(state, maker.Quote)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := c.marketDecimals(maker)
+	if err != nil {
+		return nil, err
+	}
+	baseAmt, quoteAmt, err := orderbook.FillUnits(price, amount, *dec)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &transfer{
+		baseIdx:  baseIdx,
+		quoteIdx: quoteIdx,
+		buyer:    makerIdx,
+		seller:   takerIdx,
+		baseAmt:  baseAmt,
+		quoteAmt: quoteAmt,
+		dec:      *dec,
+	}
+	if maker.Side == message.SideAsk {
+		t.buyer, t.seller = t.seller, t.buyer
+	}
+	if t.buyer == t.seller {
+		return t, nil
+	}
+
+	bals := state.Balances
+	if bals[baseIdx][t.seller].Cmp(t.baseAmt) < 0 {
+		return nil, errors.New("seller has insufficient base balance")
+	}
+	if bals[quoteIdx][t.buyer].Cmp(t.quoteAmt) < 0 {
+		return nil, errors.New("buyer has insufficient quote balance")
+	}
+	return t, nil
+}
+
+// orderBalance returns the maker's channel balance of the asset that backs the
+// order in whole units. Both assets of the order must be held by the channel.
+func (c *Client) orderBalance(ch *client.Channel, o message.Order) (*big.Rat, error) {
+	if o.Base == nil || o.Quote == nil {
+		return nil, errors.New("missing base or quote asset")
+	}
+	state := ch.State()
+	if int(o.MakerIdx) >= state.NumParts() {
+		return nil, errors.Errorf("invalid maker index %d", o.MakerIdx)
+	}
+	if _, err := assetIndex(state, o.Base); err != nil {
+		return nil, err
+	}
+	if _, err := assetIndex(state, o.Quote); err != nil {
+		return nil, err
+	}
+
+	asset := orderbook.CommittedAsset(o)
+	idx, _ := assetIndex(state, asset)
+	dec, err := c.assetDecimals(asset)
+	if err != nil {
+		return nil, err
+	}
+	return fromBaseUnits(state.Balances[idx][o.MakerIdx], dec), nil
+}
+
+// apply moves the traded amounts and the fee within the given state.
+func (t *transfer) apply(s *channel.State) {
+	bals := s.Allocation.Balances
+	bals[t.baseIdx][t.seller].Sub(bals[t.baseIdx][t.seller], t.baseAmt)
+	bals[t.baseIdx][t.buyer].Add(bals[t.baseIdx][t.buyer], t.baseAmt)
+	bals[t.quoteIdx][t.buyer].Sub(bals[t.quoteIdx][t.buyer], t.quoteAmt)
+	bals[t.quoteIdx][t.seller].Add(bals[t.quoteIdx][t.seller], t.quoteAmt)
+	if t.fee != nil {
+		bals[t.feeIdx][t.feePayer].Sub(bals[t.feeIdx][t.feePayer], t.fee)
+		bals[t.feeIdx][t.feePayee].Add(bals[t.feeIdx][t.feePayee], t.fee)
+	}
+}
+
+// reverse returns the transfer that undoes t.
+func (t *transfer) reverse() *transfer {
+	r := *t
+	r.buyer, r.seller = t.seller, t.buyer
+	r.feePayer, r.feePayee = t.feePayee, t.feePayer
+	return &r
+}
+
+// chargeFee deducts a fee of bps basis points from what the participant at
+// payer receives in the transfer and credits it to the participant at payee.
+// It returns the fee in whole units of the received asset, or nil if there is
+// none.
+func (t *transfer) chargeFee(payer, payee channel.Index, bps uint32) *big.Rat {
+	idx, amount, dec := t.quoteIdx, t.quoteAmt, t.dec.Quote
+	if payer == t.buyer {
+		idx, amount, dec = t.baseIdx, t.baseAmt, t.dec.Base
+	}
+	fee := orderbook.FeeUnits(amount, bps)
+	if fee.Sign() == 0 {
+		return nil
+	}
+	t.feeIdx, t.feePayer, t.feePayee, t.fee = idx, payer, payee, fee
+	return fromBaseUnits(fee, dec)
+}
+
+// totalFee returns the sum of the taker fees of the trades, or "" if there
+// are none.
+func totalFee(trades []message.Trade) string {
+	total := new(big.Rat)
+	for _, t := range trades {
+		if fee, err := orderbook.ParseDecimal(t.TakerFee); err == nil {
+			total.Add(total, fee)
+		}
+	}
+	if total.Sign() == 0 {
+		return ""
+	}
+	return orderbook.FormatDecimal(total)
+}
+
+// receivedAsset returns the asset that the party on the given side of a fill
+// of the order receives.
+func receivedAsset(o message.Order, side message.OrderSide) message.Asset {
+	if side == message.SideBid {
+		return o.Base
+	}
+	return o.Quote
+}
+
+// assetIndex returns the index of the asset in the channel's allocation.
+func assetIndex(state *channel.State, asset message.Asset) (int, error) {
+	for i, a := range message.MakeAssetsGPAsAssets(state.Assets) {
+		if a != nil && a.AssetType() == asset.AssetType() && a.Code() == asset.Code() {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("asset %s not in channel", asset.Code())
+}
+
+// fromBaseUnits converts an amount in the smallest unit of an asset into whole
+// units.
+func fromBaseUnits(amount *big.Int, decimals uint8) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return new(big.Rat).SetFrac(amount, scale)
+}
+
+// marketDecimals returns the decimals of the order's base and quote asset.
+func (c *Client) marketDecimals(o message.Order) (*orderbook.Decimals, error) {
+	base, err := c.assetDecimals(o.Base)
+	if err != nil {
+		return nil, errors.WithMessage(err, "base decimals")
+	}
+	quote, err := c.assetDecimals(o.Quote)
+	if err != nil {
+		return nil, errors.WithMessage(err, "quote decimals")
+	}
+	return &orderbook.Decimals{Base: base, Quote: quote}, nil
+}
+
+// SettleAuction settles the fills of a batch auction of the book. Each fill is
+// proposed by a connected participant of the maker's channel, or aborted if
+// there is none.
+func (r *Registry) SettleAuction(book *orderbook.Book, fills []*orderbook.Fill) {
+	for _, f := range fills {
+		c, ch, ok := r.participant(f.Maker.ChannelID)
+		if !ok {
+			log.Warnf("order book: no participant of channel %x connected to settle auction fill of order %s", f.Maker.ChannelID, f.Maker.ID)
+			book.AbortFill(f)
+			continue
+		}
+		if _, err := c.settleFill(ch, book, f); err != nil {
+			c.log("settling auction fill of order ", f.Maker.ID, ": ", err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"github.com/perun-network/perun-dex-websocket/internal/orderbook"
+	"perun.network/go-perun/channel"
+)
+
+func TestChargeFee(t *testing.T) {
+	const trader, hub = channel.Index(0), channel.Index(1)
+	tests := []struct {
+		name  string
+		buyer channel.Index
+		bps   uint32
+		// fee is the charged fee in whole units, "" for none; balances
+		// are the balances of the trader and the hub in the base and the
+		// quote asset after the trade.
+		fee      string
+		balances [2][2]int64
+	}{
+		{name: "buyer pays in base", buyer: trader, bps: 100, fee: "0.002", balances: [2][2]int64{{1198, 802}, {500, 1500}}},
+		{name: "seller pays in quote", buyer: hub, bps: 100, fee: "0.005", balances: [2][2]int64{{800, 1200}, {1495, 505}}},
+		{name: "rounded down to zero", buyer: trader, bps: 1, balances: [2][2]int64{{1200, 800}, {500, 1500}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &transfer{
+				baseIdx:  0,
+				quoteIdx: 1,
+				buyer:    tt.buyer,
+				seller:   1 - tt.buyer,
+				baseAmt:  big.NewInt(200),
+				quoteAmt: big.NewInt(500),
+				dec:      orderbook.Decimals{Base: 3, Quote: 3},
+			}
+			fee := tr.chargeFee(trader, hub, tt.bps)
+			if tt.fee == "" {
+				if fee != nil {
+					t.Fatalf("charged %v, want no fee", fee)
+				}
+			} else if fee == nil || orderbook.FormatDecimal(fee) != tt.fee {
+				t.Fatalf("charged %v, want %s", fee, tt.fee)
+			}
+
+			state := &channel.State{Allocation: channel.Allocation{Balances: channel.Balances{
+				{big.NewInt(1000), big.NewInt(1000)},
+				{big.NewInt(1000), big.NewInt(1000)},
+			}}}
+			tr.apply(state)
+			for asset, want := range tt.balances {
+				for idx, bal := range want {
+					if got := state.Allocation.Balances[asset][idx].Int64(); got != bal {
+						t.Errorf("asset %d of participant %d: balance %d, want %d", asset, idx, got, bal)
+					}
+				}
+			}
+
+			// The reverse transfer restores the balances, fee included.
+			tr.reverse().apply(state)
+			for asset, bals := range state.Allocation.Balances {
+				for idx, bal := range bals {
+					if bal.Int64() != 1000 {
+						t.Errorf("asset %d of participant %d: balance %v after reverse", asset, idx, bal)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHubFee(t *testing.T) {
+	base := &message.SolanaAsset{Mint: "base"}
+	quote := &message.SolanaAsset{Mint: "quote"}
+	c := &Client{fees: orderbook.FeeSchedule{Assets: map[string]orderbook.FeeRates{
+		base.AssetType() + ":" + base.Code():   {Maker: 50, Taker: 100},
+		quote.AssetType() + ":" + quote.Code(): {Maker: 50, Taker: 100},
+	}}}
+	const trader, hub = channel.Index(0), channel.Index(1)
+
+	tests := []struct {
+		name string
+		// maker is the participant whose ask is filled.
+		maker    channel.Index
+		makerFee string
+		takerFee string
+		// balances are the balances of the trader and the hub in the base
+		// and the quote asset after the trade.
+		balances [2][2]int64
+	}{
+		{name: "hub is maker", maker: hub, takerFee: "0.002", balances: [2][2]int64{{1198, 802}, {500, 1500}}},
+		// 50 bps of 500 units are rounded down to 2.
+		{name: "hub is taker", maker: trader, makerFee: "0.002", balances: [2][2]int64{{800, 1200}, {1498, 502}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &orderbook.Fill{
+				Maker: message.Order{
+					MakerIdx: tt.maker,
+					Side:     message.SideAsk,
+					Base:     base,
+					Quote:    quote,
+				},
+				TakerSide: message.SideBid,
+				TakerIdx:  1 - tt.maker,
+			}
+			tr := &transfer{
+				baseIdx:  0,
+				quoteIdx: 1,
+				buyer:    f.TakerIdx,
+				seller:   tt.maker,
+				baseAmt:  big.NewInt(200),
+				quoteAmt: big.NewInt(500),
+				dec:      orderbook.Decimals{Base: 3, Quote: 3},
+			}
+
+			s := c.hubFee(hub, f, tr)
+			format := func(fee *big.Rat) string {
+				if fee == nil {
+					return ""
+				}
+				return orderbook.FormatDecimal(fee)
+			}
+			if got := format(s.MakerFee); got != tt.makerFee {
+				t.Errorf("maker fee %q, want %q", got, tt.makerFee)
+			}
+			if got := format(s.TakerFee); got != tt.takerFee {
+				t.Errorf("taker fee %q, want %q", got, tt.takerFee)
+			}
+
+			state := &channel.State{Allocation: channel.Allocation{Balances: channel.Balances{
+				{big.NewInt(1000), big.NewInt(1000)},
+				{big.NewInt(1000), big.NewInt(1000)},
+			}}}
+			tr.apply(state)
+			for asset, want := range tt.balances {
+				for idx, bal := range want {
+					if got := state.Allocation.Balances[asset][idx].Int64(); got != bal {
+						t.Errorf("asset %d of participant %d: balance %d, want %d", asset, idx, got, bal)
+					}
+				}
+			}
+		})
+	}
+}
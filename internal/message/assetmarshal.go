@@ -159,48 +159,72 @@ func (c Order) MarshalJSON() ([]byte, error) {
 	}
 
 	return json.Marshal(struct {
-		ID        OrderID         `json:"id"`
-		ChannelID channel.ID      `json:"channelID"`
-		MakerIdx  channel.Index   `json:"makerIdx"`  // who created it, 0/1
-		Side      OrderSide       `json:"side"`      // "bid" or "ask"
-		Base      json.RawMessage `json:"base"`      // asset being bought/sold
-		Quote     json.RawMessage `json:"quote"`     // pricing asset
-		Price     string          `json:"price"`     // decimal string
-		Amount    string          `json:"amount"`    // base units
-		Status    OrderStatus     `json:"status"`    // lifecycle status
-		CreatedAt int64           `json:"createdAt"` // unix seconds
-		ExpiresAt *int64          `json:"expiresAt,omitempty"`
-		ClientTag string          `json:"clientTag,omitempty"` // optional client tag
+		ID          OrderID         `json:"id"`
+		ChannelID   channel.ID      `json:"channelID"`
+		MakerIdx    channel.Index   `json:"makerIdx"`  // who created it, 0/1
+		Side        OrderSide       `json:"side"`      // "bid" or "ask"
+		Base        json.RawMessage `json:"base"`      // asset being bought/sold
+		Quote       json.RawMessage `json:"quote"`     // pricing asset
+		Price       string          `json:"price"`     // decimal string
+		Amount      string          `json:"amount"`    // base units
+		Status      OrderStatus     `json:"status"`    // lifecycle status
+		CreatedAt   int64           `json:"createdAt"` // unix seconds
+		ExpiresAt   *int64          `json:"expiresAt,omitempty"`
+		ClientTag   string          `json:"clientTag,omitempty"` // optional client tag
+		Remaining   string          `json:"remaining,omitempty"` // unfilled base units
+		Filled      string          `json:"filled,omitempty"`    // filled base units
+		Type        OrderType       `json:"type,omitempty"`
+		TimeInForce TimeInForce     `json:"timeInForce,omitempty"`
+		PostOnly    bool            `json:"postOnly,omitempty"`
+		StopPrice   string          `json:"stopPrice,omitempty"`
+		Nonce       uint64          `json:"nonce"`
+		Signature   []byte          `json:"signature,omitempty"`
 	}{
-		ID:        c.ID,
-		ChannelID: c.ChannelID,
-		MakerIdx:  c.MakerIdx,
-		Side:      c.Side,
-		Base:      baseJSON,
-		Quote:     quoteJSON,
-		Price:     c.Price,
-		Amount:    c.Amount,
-		Status:    c.Status,
-		CreatedAt: c.CreatedAt,
-		ExpiresAt: c.ExpiresAt,
-		ClientTag: c.ClientTag,
+		ID:          c.ID,
+		ChannelID:   c.ChannelID,
+		MakerIdx:    c.MakerIdx,
+		Side:        c.Side,
+		Base:        baseJSON,
+		Quote:       quoteJSON,
+		Price:       c.Price,
+		Amount:      c.Amount,
+		Status:      c.Status,
+		CreatedAt:   c.CreatedAt,
+		ExpiresAt:   c.ExpiresAt,
+		ClientTag:   c.ClientTag,
+		Remaining:   c.Remaining,
+		Filled:      c.Filled,
+		Type:        c.Type,
+		TimeInForce: c.TimeInForce,
+		PostOnly:    c.PostOnly,
+		StopPrice:   c.StopPrice,
+		Nonce:       c.Nonce,
+		Signature:   c.Signature,
 	})
 }
 
 func (c *Order) UnmarshalJSON(data []byte) error {
 	var temp struct {
-		ID        OrderID         `json:"id"`
-		ChannelID channel.ID      `json:"channelID"`
-		MakerIdx  channel.Index   `json:"makerIdx"`  // who created it, 0/1
-		Side      OrderSide       `json:"side"`      // "bid" or "ask"
-		Base      json.RawMessage `json:"base"`      // asset being bought/sold
-		Quote     json.RawMessage `json:"quote"`     // pricing asset
-		Price     string          `json:"price"`     // decimal string
-		Amount    string          `json:"amount"`    // base units
-		Status    OrderStatus     `json:"status"`    // lifecycle status
-		CreatedAt int64           `json:"createdAt"` // unix seconds
-		ExpiresAt *int64          `json:"expiresAt,omitempty"`
-		ClientTag string          `json:"clientTag,omitempty"` // optional client tag
+		ID          OrderID         `json:"id"`
+		ChannelID   channel.ID      `json:"channelID"`
+		MakerIdx    channel.Index   `json:"makerIdx"`  // who created it, 0/1
+		Side        OrderSide       `json:"side"`      // "bid" or "ask"
+		Base        json.RawMessage `json:"base"`      // asset being bought/sold
+		Quote       json.RawMessage `json:"quote"`     // pricing asset
+		Price       string          `json:"price"`     // decimal string
+		Amount      string          `json:"amount"`    // base units
+		Status      OrderStatus     `json:"status"`    // lifecycle status
+		CreatedAt   int64           `json:"createdAt"` // unix seconds
+		ExpiresAt   *int64          `json:"expiresAt,omitempty"`
+		ClientTag   string          `json:"clientTag,omitempty"` // optional client tag
+		Remaining   string          `json:"remaining,omitempty"` // unfilled base units
+		Filled      string          `json:"filled,omitempty"`    // filled base units
+		Type        OrderType       `json:"type,omitempty"`
+		TimeInForce TimeInForce     `json:"timeInForce,omitempty"`
+		PostOnly    bool            `json:"postOnly,omitempty"`
+		StopPrice   string          `json:"stopPrice,omitempty"`
+		Nonce       uint64          `json:"nonce"`
+		Signature   []byte          `json:"signature,omitempty"`
 	}
 
 	if err := json.Unmarshal(data, &temp); err != nil {
@@ -227,6 +251,14 @@ func (c *Order) UnmarshalJSON(data []byte) error {
 	c.CreatedAt = temp.CreatedAt
 	c.ExpiresAt = temp.ExpiresAt
 	c.ClientTag = temp.ClientTag
+	c.Remaining = temp.Remaining
+	c.Filled = temp.Filled
+	c.Type = temp.Type
+	c.TimeInForce = temp.TimeInForce
+	c.PostOnly = temp.PostOnly
+	c.StopPrice = temp.StopPrice
+	c.Nonce = temp.Nonce
+	c.Signature = temp.Signature
 	return nil
 }
 
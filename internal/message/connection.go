@@ -35,6 +35,17 @@ type Connection struct {
 	responseHandlers *messageHandlerMap
 }
 
+// ErrDetached is returned when reading from or writing to a detached
+// connection.
+var ErrDetached = errors.New("client not connected")
+
+// NewDetachedConnection creates a connection without a websocket, on which
+// every read, write and request fails with ErrDetached. It stands in for the
+// connection of a client whose channels are watched while it is offline.
+func NewDetachedConnection() *Connection {
+	return &Connection{responseHandlers: newMessageHandlerMap()}
+}
+
 // NewConnection creates a new connection from a websocket connection.
 func NewConnection(conn *websocket.Conn) *Connection {
 	return &Connection{
@@ -45,6 +56,9 @@ func NewConnection(conn *websocket.Conn) *Connection {
 }
 
 func (c *Connection) Read() (msg Message, err error) {
+	if c.conn == nil {
+		return nil, ErrDetached
+	}
 	c.readMu.Lock()
 	defer c.readMu.Unlock()
 
@@ -78,6 +92,9 @@ func (c *Connection) Write(msg Message) (err error) {
 }
 
 func (c *Connection) write(messageType int, data []byte) error {
+	if c.conn == nil {
+		return ErrDetached
+	}
 	c.writeMu.Lock()
 	defer c.writeMu.Unlock()
 	return c.conn.WriteMessage(messageType, data)
@@ -168,6 +185,9 @@ func (c *Connection) Close() error {
 	if c.onClose != nil {
 		c.onClose()
 	}
+	if c.conn == nil {
+		return nil
+	}
 	return c.conn.Close()
 }
 
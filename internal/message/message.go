@@ -63,10 +63,36 @@ type (
 	// This is the only message sent by the WebSocket client that is not wrapped
 	// in a Request or Response.
 
+	// AuthChallenge is sent to the WebSocket client after the initialization
+	// message if the server persists channels. The client proves that it
+	// controls its L1 addresses by answering with an AuthResponse.
+	AuthChallenge struct {
+		Challenge string `json:"challenge"`
+	}
+
+	// AuthResponse carries the signatures of the challenge by the client's
+	// Ethereum account, as by personal_sign, and its Solana account, over
+	// the UTF-8 bytes of the challenge. Like the initialization message, it
+	// is not wrapped in a Request or Response.
+	AuthResponse struct {
+		EthSignature []byte `json:"ethSignature"`
+		SolSignature []byte `json:"solSignature"`
+	}
+
 	// Initialized is sent to the WebSocket client after the Perun client has
 	// been successfully started.
 	Initialized struct {
 		L2Address common.Address `json:"l2Address"`
+		// Channels are the channels of a returning client that were
+		// restored from the server's channel database.
+		Channels []RestoredChannel `json:"channels,omitempty"`
+	}
+
+	// RestoredChannel is a channel that was restored for a returning client
+	// and in which it is the participant at index Idx.
+	RestoredChannel struct {
+		ID  channel.ID    `json:"id"`
+		Idx channel.Index `json:"idx"`
 	}
 
 	// ChainInfo is the representation of a chain.
@@ -308,18 +334,34 @@ type (
 		Err        string            `json:"error"`
 	}
 
-	// CreateOrder is sent by the maker to propose a new order to the peer.
+	// CreateOrder is sent by the maker to propose a new order to the peer. The
+	// order's ID and MakerIdx are set by the server; the client identifies the
+	// order by its ClientTag.
 	CreateOrder struct {
 		Order Order `json:"order"`
 	}
 
 	// CreateOrderAck is returned by the taker (or your client) indicating local acceptance
-	// of displaying/keeping the order in the off-chain book; trade still requires ch.Update.
+	// of displaying/keeping the order in the off-chain book. Trades lists the matches
+	// against resting orders that were settled with a ch.Update. ID is assigned by
+	// the server; ClientTag echoes the tag of the CreateOrder.
 	CreateOrderAck struct {
 		ID        OrderID `json:"id"`
+		ClientTag string  `json:"clientTag,omitempty"`
 		Accepted  bool    `json:"accepted"`
 		Reason    string  `json:"reason,omitempty"`
 		TotalOpen uint64  `json:"totalOpen"`
+		Trades    []Trade `json:"trades,omitempty"`
+		// Canceled is the amount of an IOC or market order that could not be
+		// matched and was dropped instead of resting in the book, plus the
+		// amount of failed fills that could not be given back to the order.
+		Canceled string `json:"canceled,omitempty"`
+		// SelfTrade is set if Canceled was dropped by self-trade prevention.
+		SelfTrade bool `json:"selfTrade,omitempty"`
+		// Fee is the total taker fee of Trades in whole units of the asset
+		// the order received. Fees the order pays as a maker once it rests
+		// are reported by the trades that fill it.
+		Fee string `json:"fee,omitempty"`
 	}
 
 	// CancelOrder removes an active order from the off-chain book.
@@ -337,9 +379,29 @@ type (
 		TotalOpen uint64  `json:"totalOpen"`
 	}
 
-	// AcceptOrder signals the taker wants to accept an order; the maker then proceeds
-	// to invoke ch.Update (or the taker, depending on your trading protocol) to settle.
-	// This is a control-plane message; the asset movement will be in the channel update.
+	// ReplaceOrder changes the price and/or amount of a resting order in
+	// place. Amount is the new total amount including what is already filled;
+	// empty fields keep their current value.
+	ReplaceOrder struct {
+		ChannelID channel.ID `json:"channelID"`
+		ID        OrderID    `json:"id"`
+		Price     string     `json:"price,omitempty"`
+		Amount    string     `json:"amount,omitempty"`
+	}
+
+	// ReplaceOrderAck confirms the replacement. Remaining is the order's open
+	// amount afterwards.
+	ReplaceOrderAck struct {
+		ID        OrderID `json:"id"`
+		Success   bool    `json:"success"`
+		Reason    string  `json:"reason,omitempty"`
+		Remaining string  `json:"remaining,omitempty"`
+		TotalOpen uint64  `json:"totalOpen"`
+	}
+
+	// AcceptOrder signals the taker wants to accept an order. The taker's client
+	// settles the fill with a ch.Update computed from the order and only marks
+	// the order filled once the peer accepted the update.
 	AcceptOrder struct {
 		ChannelID channel.ID `json:"channelID"`
 		ID        OrderID    `json:"id"`
@@ -347,26 +409,201 @@ type (
 		Amount string `json:"amount,omitempty"`
 	}
 
-	// AcceptOrderAck returns the decision prior to any ch.Update.
+	// AcceptOrderAck is returned once the channel update settling the fill was
+	// accepted or rejected by the peer. Amount is the base amount taken by this
+	// acceptance and Remaining what is left open.
 	AcceptOrderAck struct {
-		ID       OrderID `json:"id"`
-		Accepted bool    `json:"accepted"`
-		Reason   string  `json:"reason,omitempty"`
+		ID        OrderID `json:"id"`
+		Accepted  bool    `json:"accepted"`
+		Reason    string  `json:"reason,omitempty"`
+		Amount    string  `json:"amount,omitempty"`
+		Remaining string  `json:"remaining,omitempty"`
+		Trade     *Trade  `json:"trade,omitempty"`
+		// Fee is the taker fee the accepting participant paid for Trade in
+		// whole units of the asset it received.
+		Fee string `json:"fee,omitempty"`
 	}
 
 	// GetOrderBook requests either a snapshot or a delta since the given sequence.
-	// If SinceSequence == 0, a snapshot should be returned.
+	// If SinceSequence == 0, or the sequence is no longer covered by the book's
+	// journal, a snapshot is returned.
 	GetOrderBook struct {
 		ChannelID     channel.ID `json:"channelID"`
 		SinceSequence uint64     `json:"sinceSequence"`
 	}
 
 	// GetOrderBookResponse returns a snapshot or delta; only one of the fields is set.
+	// The delta merges all changes after SinceSequence up to its Sequence.
 	GetOrderBookResponse struct {
 		Snapshot *OrderBookSnapshot `json:"snapshot,omitempty"`
 		Delta    *OrderBookDelta    `json:"delta,omitempty"`
 	}
 
+	// GetDepth requests the top Levels price levels per side of the channel's
+	// book, aggregated per price. Market optionally restricts the response to
+	// a single pair; Levels <= 0 selects the server default.
+	GetDepth struct {
+		ChannelID channel.ID `json:"channelID"`
+		Levels    int        `json:"levels,omitempty"`
+		Market    string     `json:"market,omitempty"`
+	}
+
+	// GetDepthResponse returns the aggregated depth of the book.
+	GetDepthResponse struct {
+		Depth OrderBookDepth `json:"depth"`
+	}
+
+	// GetTrades requests the trades of the channel's book after AfterSequence,
+	// oldest first. Market, From and To optionally restrict the trades to one
+	// pair and to timestamps in [From, To); Limit <= 0 selects the server
+	// default.
+	GetTrades struct {
+		ChannelID     channel.ID `json:"channelID"`
+		Market        string     `json:"market,omitempty"`
+		From          int64      `json:"from,omitempty"`
+		To            int64      `json:"to,omitempty"`
+		AfterSequence uint64     `json:"afterSequence,omitempty"`
+		Limit         int        `json:"limit,omitempty"`
+	}
+
+	// GetTradesResponse returns a page of trades. If More is set, the next
+	// page starts after the sequence of the last trade.
+	GetTradesResponse struct {
+		Trades []Trade `json:"trades"`
+		More   bool    `json:"more"`
+	}
+
+	// GetCandles requests OHLCV candles of Interval seconds for a market of
+	// the channel's book, oldest first. Intervals without trades are left
+	// out. From and To optionally restrict the candles to start times in
+	// [From, To); Limit <= 0 selects the server default.
+	GetCandles struct {
+		ChannelID channel.ID `json:"channelID"`
+		Market    string     `json:"market"`
+		Interval  int64      `json:"interval"`
+		From      int64      `json:"from,omitempty"`
+		To        int64      `json:"to,omitempty"`
+		Limit     int        `json:"limit,omitempty"`
+	}
+
+	// GetCandlesResponse returns the requested candles.
+	GetCandlesResponse struct {
+		Candles []Candle `json:"candles"`
+	}
+
+	// EnableConsolidatedBook is sent by a hub to let the orders of all its
+	// channels share one book per asset pair, with the hub as counterparty of
+	// every fill.
+	EnableConsolidatedBook struct{}
+
+	// ConsolidatedBookEnabled returns the ID of the hub's consolidated book
+	// and the channels that were routed to it. Traders address the book by
+	// the ID of their channel with the hub.
+	ConsolidatedBookEnabled struct {
+		BookID   channel.ID   `json:"bookID"`
+		Channels []channel.ID `json:"channels"`
+	}
+
+	// SetAuctionMode switches the channel's book to frequent batch auctions
+	// that clear every Interval seconds, or back to continuous matching if
+	// Interval is 0.
+	SetAuctionMode struct {
+		ChannelID channel.ID `json:"channelID"`
+		Interval  int64      `json:"interval"`
+	}
+
+	// SetAuctionModeAck reports whether the mode was changed. Trades lists
+	// the trades of the final auction when switching back to continuous
+	// matching.
+	SetAuctionModeAck struct {
+		ChannelID channel.ID `json:"channelID"`
+		Interval  int64      `json:"interval"`
+		Success   bool       `json:"success"`
+		Reason    string     `json:"reason,omitempty"`
+		Trades    []Trade    `json:"trades,omitempty"`
+	}
+
+	// GetStreamToken requests a token that authenticates the client on the
+	// order book stream.
+	GetStreamToken struct{}
+
+	// StreamToken is the token for the order book stream. It is valid until
+	// ExpiresAt (unix seconds) or until the client disconnects.
+	StreamToken struct {
+		Token     string `json:"token"`
+		ExpiresAt int64  `json:"expiresAt"`
+	}
+
+	// SetOrderBookVisibility marks the channel's book as public, so that any
+	// authenticated client may stream it, or as private again.
+	SetOrderBookVisibility struct {
+		ChannelID channel.ID `json:"channelID"`
+		Public    bool       `json:"public"`
+	}
+
+	// SetOrderBookVisibilityAck reports whether the visibility was changed.
+	SetOrderBookVisibilityAck struct {
+		ChannelID channel.ID `json:"channelID"`
+		Public    bool       `json:"public"`
+		Success   bool       `json:"success"`
+		Reason    string     `json:"reason,omitempty"`
+	}
+
+	// SetCancelOnDisconnect makes the server cancel all open orders of the
+	// client in every book once its connection drops, or stops doing so if
+	// Enabled is false. The orders are only canceled if the client did not
+	// return within GracePeriod seconds.
+	SetCancelOnDisconnect struct {
+		Enabled     bool  `json:"enabled"`
+		GracePeriod int64 `json:"gracePeriod,omitempty"`
+	}
+
+	// SetCancelOnDisconnectAck reports whether the setting was changed.
+	SetCancelOnDisconnectAck struct {
+		Enabled     bool   `json:"enabled"`
+		GracePeriod int64  `json:"gracePeriod,omitempty"`
+		Success     bool   `json:"success"`
+		Reason      string `json:"reason,omitempty"`
+	}
+
+	// Subscribe is sent over the multiplexed order book stream to receive a
+	// topic of the channel's book. Since resumes the book topic like the
+	// stream's since parameter; Levels and Market configure the depth topic.
+	Subscribe struct {
+		ChannelID channel.ID  `json:"channelID"`
+		Topic     StreamTopic `json:"topic"`
+		Since     uint64      `json:"since,omitempty"`
+		Levels    int         `json:"levels,omitempty"`
+		Market    string      `json:"market,omitempty"`
+	}
+
+	// Unsubscribe ends a subscription of the multiplexed order book stream.
+	Unsubscribe struct {
+		ChannelID channel.ID  `json:"channelID"`
+		Topic     StreamTopic `json:"topic"`
+	}
+
+	// Subscribed confirms a Subscribe. The topic's frames follow.
+	Subscribed struct {
+		ChannelID channel.ID  `json:"channelID"`
+		Topic     StreamTopic `json:"topic"`
+	}
+
+	// Unsubscribed confirms an Unsubscribe. No more frames of the topic
+	// follow.
+	Unsubscribed struct {
+		ChannelID channel.ID  `json:"channelID"`
+		Topic     StreamTopic `json:"topic"`
+	}
+
+	// StreamFrame carries a frame of the multiplexed order book stream
+	// tagged with the channel and topic it belongs to.
+	StreamFrame struct {
+		ChannelID channel.ID  `json:"channelID"`
+		Topic     StreamTopic `json:"topic"`
+		Frame     *JSONObject `json:"frame"`
+	}
+
 	// Error is sent as a response to notify the client/WebSocket about an error.
 	Error struct {
 		Err string `json:"error"`
@@ -380,116 +617,174 @@ type (
 // messageTypes is a map from the message type names to their reflected type.
 // It is used to unmarshal messages when having their message type name.
 var messageTypes = map[string]reflect.Type{
-	(*Request)(nil).messageType():                 reflect.ValueOf((*Request)(nil)).Type().Elem(),
-	(*Response)(nil).messageType():                reflect.ValueOf((*Response)(nil)).Type().Elem(),
-	(*EthereumInitialize)(nil).messageType():      reflect.ValueOf((*EthereumInitialize)(nil)).Type().Elem(),
-	(*SolanaInitialize)(nil).messageType():        reflect.ValueOf((*SolanaInitialize)(nil)).Type().Elem(),
-	(*CrossContractInitialize)(nil).messageType(): reflect.ValueOf((*CrossContractInitialize)(nil)).Type().Elem(),
-	(*Initialized)(nil).messageType():             reflect.ValueOf((*Initialized)(nil)).Type().Elem(),
-	(*GetChains)(nil).messageType():               reflect.ValueOf((*GetChains)(nil)).Type().Elem(),
-	(*GetChainsResponse)(nil).messageType():       reflect.ValueOf((*GetChainsResponse)(nil)).Type().Elem(),
-	(*GetAssets)(nil).messageType():               reflect.ValueOf((*GetAssets)(nil)).Type().Elem(),
-	(*GetAssetsResponse)(nil).messageType():       reflect.ValueOf((*GetAssetsResponse)(nil)).Type().Elem(),
-	(*GetDecimals)(nil).messageType():             reflect.ValueOf((*GetDecimals)(nil)).Type().Elem(),
-	(*GetDecimalsResponse)(nil).messageType():     reflect.ValueOf((*GetDecimalsResponse)(nil)).Type().Elem(),
-	(*GetBalance)(nil).messageType():              reflect.ValueOf((*GetBalance)(nil)).Type().Elem(),
-	(*GetHubBalance)(nil).messageType():           reflect.ValueOf((*GetHubBalance)(nil)).Type().Elem(),
-	(*GetBalanceResponse)(nil).messageType():      reflect.ValueOf((*GetBalanceResponse)(nil)).Type().Elem(),
-	(*GetTimeout)(nil).messageType():              reflect.ValueOf((*GetTimeout)(nil)).Type().Elem(),
-	(*GetTimeoutResponse)(nil).messageType():      reflect.ValueOf((*GetTimeoutResponse)(nil)).Type().Elem(),
-	(*GetQuote)(nil).messageType():                reflect.ValueOf((*GetQuote)(nil)).Type().Elem(),
-	(*GetQuoteResponse)(nil).messageType():        reflect.ValueOf((*GetQuoteResponse)(nil)).Type().Elem(),
-	(*GetFunds)(nil).messageType():                reflect.ValueOf((*GetFunds)(nil)).Type().Elem(),
-	(*GetFundsResponse)(nil).messageType():        reflect.ValueOf((*GetFundsResponse)(nil)).Type().Elem(),
-	(*OpenChannel)(nil).messageType():             reflect.ValueOf((*OpenChannel)(nil)).Type().Elem(),
-	(*UpdateChannel)(nil).messageType():           reflect.ValueOf((*UpdateChannel)(nil)).Type().Elem(),
-	(*ChannelProposal)(nil).messageType():         reflect.ValueOf((*ChannelProposal)(nil)).Type().Elem(),
-	(*ProposalResponse)(nil).messageType():        reflect.ValueOf((*ProposalResponse)(nil)).Type().Elem(),
-	(*ChannelCreated)(nil).messageType():          reflect.ValueOf((*ChannelCreated)(nil)).Type().Elem(),
-	(*CloseChannel)(nil).messageType():            reflect.ValueOf((*CloseChannel)(nil)).Type().Elem(),
-	(*ChannelClosed)(nil).messageType():           reflect.ValueOf((*ChannelClosed)(nil)).Type().Elem(),
-	(*GetChannelInfo)(nil).messageType():          reflect.ValueOf((*GetChannelInfo)(nil)).Type().Elem(),
-	(*ChannelInfo)(nil).messageType():             reflect.ValueOf((*ChannelInfo)(nil)).Type().Elem(),
-	(*GetSignedState)(nil).messageType():          reflect.ValueOf((*GetSignedState)(nil)).Type().Elem(),
-	(*SendSignedState)(nil).messageType():         reflect.ValueOf((*SendSignedState)(nil)).Type().Elem(),
-	(*SignedState)(nil).messageType():             reflect.ValueOf((*SignedState)(nil)).Type().Elem(),
-	(*SignETHData)(nil).messageType():             reflect.ValueOf((*SignETHData)(nil)).Type().Elem(),
-	(*SignSolData)(nil).messageType():             reflect.ValueOf((*SignSolData)(nil)).Type().Elem(),
-	(*SendETHTx)(nil).messageType():               reflect.ValueOf((*SendETHTx)(nil)).Type().Elem(),
-	(*SendETHTxResponse)(nil).messageType():       reflect.ValueOf((*SendETHTxResponse)(nil)).Type().Elem(),
-	(*SendSolTx)(nil).messageType():               reflect.ValueOf((*SendSolTx)(nil)).Type().Elem(),
-	(*SendSolTxResponse)(nil).messageType():       reflect.ValueOf((*SendSolTxResponse)(nil)).Type().Elem(),
-	(*SignResponse)(nil).messageType():            reflect.ValueOf((*SignResponse)(nil)).Type().Elem(),
-	(*FundingError)(nil).messageType():            reflect.ValueOf((*FundingError)(nil)).Type().Elem(),
-	(*OrderBookSnapshot)(nil).messageType():       reflect.ValueOf((*OrderBookSnapshot)(nil)).Type().Elem(),
-	(*OrderBookDelta)(nil).messageType():          reflect.ValueOf((*OrderBookDelta)(nil)).Type().Elem(),
-	(*CreateOrder)(nil).messageType():             reflect.ValueOf((*CreateOrder)(nil)).Type().Elem(),
-	(*CreateOrderAck)(nil).messageType():          reflect.ValueOf((*CreateOrderAck)(nil)).Type().Elem(),
-	(*CancelOrder)(nil).messageType():             reflect.ValueOf((*CancelOrder)(nil)).Type().Elem(),
-	(*CancelOrderAck)(nil).messageType():          reflect.ValueOf((*CancelOrderAck)(nil)).Type().Elem(),
-	(*AcceptOrder)(nil).messageType():             reflect.ValueOf((*AcceptOrder)(nil)).Type().Elem(),
-	(*AcceptOrderAck)(nil).messageType():          reflect.ValueOf((*AcceptOrderAck)(nil)).Type().Elem(),
-	(*GetOrderBook)(nil).messageType():            reflect.ValueOf((*GetOrderBook)(nil)).Type().Elem(),
-	(*GetOrderBookResponse)(nil).messageType():    reflect.ValueOf((*GetOrderBookResponse)(nil)).Type().Elem(),
-	(*Error)(nil).messageType():                   reflect.ValueOf((*Error)(nil)).Type().Elem(),
-	(*Success)(nil).messageType():                 reflect.ValueOf((*Success)(nil)).Type().Elem(),
-	(*MockMessage)(nil).messageType():             reflect.ValueOf((*MockMessage)(nil)).Type().Elem(),
+	(*Request)(nil).messageType():                   reflect.ValueOf((*Request)(nil)).Type().Elem(),
+	(*Response)(nil).messageType():                  reflect.ValueOf((*Response)(nil)).Type().Elem(),
+	(*EthereumInitialize)(nil).messageType():        reflect.ValueOf((*EthereumInitialize)(nil)).Type().Elem(),
+	(*SolanaInitialize)(nil).messageType():          reflect.ValueOf((*SolanaInitialize)(nil)).Type().Elem(),
+	(*CrossContractInitialize)(nil).messageType():   reflect.ValueOf((*CrossContractInitialize)(nil)).Type().Elem(),
+	(*AuthChallenge)(nil).messageType():             reflect.ValueOf((*AuthChallenge)(nil)).Type().Elem(),
+	(*AuthResponse)(nil).messageType():              reflect.ValueOf((*AuthResponse)(nil)).Type().Elem(),
+	(*Initialized)(nil).messageType():               reflect.ValueOf((*Initialized)(nil)).Type().Elem(),
+	(*GetChains)(nil).messageType():                 reflect.ValueOf((*GetChains)(nil)).Type().Elem(),
+	(*GetChainsResponse)(nil).messageType():         reflect.ValueOf((*GetChainsResponse)(nil)).Type().Elem(),
+	(*GetAssets)(nil).messageType():                 reflect.ValueOf((*GetAssets)(nil)).Type().Elem(),
+	(*GetAssetsResponse)(nil).messageType():         reflect.ValueOf((*GetAssetsResponse)(nil)).Type().Elem(),
+	(*GetDecimals)(nil).messageType():               reflect.ValueOf((*GetDecimals)(nil)).Type().Elem(),
+	(*GetDecimalsResponse)(nil).messageType():       reflect.ValueOf((*GetDecimalsResponse)(nil)).Type().Elem(),
+	(*GetBalance)(nil).messageType():                reflect.ValueOf((*GetBalance)(nil)).Type().Elem(),
+	(*GetHubBalance)(nil).messageType():             reflect.ValueOf((*GetHubBalance)(nil)).Type().Elem(),
+	(*GetBalanceResponse)(nil).messageType():        reflect.ValueOf((*GetBalanceResponse)(nil)).Type().Elem(),
+	(*GetTimeout)(nil).messageType():                reflect.ValueOf((*GetTimeout)(nil)).Type().Elem(),
+	(*GetTimeoutResponse)(nil).messageType():        reflect.ValueOf((*GetTimeoutResponse)(nil)).Type().Elem(),
+	(*GetQuote)(nil).messageType():                  reflect.ValueOf((*GetQuote)(nil)).Type().Elem(),
+	(*GetQuoteResponse)(nil).messageType():          reflect.ValueOf((*GetQuoteResponse)(nil)).Type().Elem(),
+	(*GetFunds)(nil).messageType():                  reflect.ValueOf((*GetFunds)(nil)).Type().Elem(),
+	(*GetFundsResponse)(nil).messageType():          reflect.ValueOf((*GetFundsResponse)(nil)).Type().Elem(),
+	(*OpenChannel)(nil).messageType():               reflect.ValueOf((*OpenChannel)(nil)).Type().Elem(),
+	(*UpdateChannel)(nil).messageType():             reflect.ValueOf((*UpdateChannel)(nil)).Type().Elem(),
+	(*ChannelProposal)(nil).messageType():           reflect.ValueOf((*ChannelProposal)(nil)).Type().Elem(),
+	(*ProposalResponse)(nil).messageType():          reflect.ValueOf((*ProposalResponse)(nil)).Type().Elem(),
+	(*ChannelCreated)(nil).messageType():            reflect.ValueOf((*ChannelCreated)(nil)).Type().Elem(),
+	(*CloseChannel)(nil).messageType():              reflect.ValueOf((*CloseChannel)(nil)).Type().Elem(),
+	(*ChannelClosed)(nil).messageType():             reflect.ValueOf((*ChannelClosed)(nil)).Type().Elem(),
+	(*GetChannelInfo)(nil).messageType():            reflect.ValueOf((*GetChannelInfo)(nil)).Type().Elem(),
+	(*ChannelInfo)(nil).messageType():               reflect.ValueOf((*ChannelInfo)(nil)).Type().Elem(),
+	(*GetSignedState)(nil).messageType():            reflect.ValueOf((*GetSignedState)(nil)).Type().Elem(),
+	(*SendSignedState)(nil).messageType():           reflect.ValueOf((*SendSignedState)(nil)).Type().Elem(),
+	(*SignedState)(nil).messageType():               reflect.ValueOf((*SignedState)(nil)).Type().Elem(),
+	(*SignETHData)(nil).messageType():               reflect.ValueOf((*SignETHData)(nil)).Type().Elem(),
+	(*SignSolData)(nil).messageType():               reflect.ValueOf((*SignSolData)(nil)).Type().Elem(),
+	(*SendETHTx)(nil).messageType():                 reflect.ValueOf((*SendETHTx)(nil)).Type().Elem(),
+	(*SendETHTxResponse)(nil).messageType():         reflect.ValueOf((*SendETHTxResponse)(nil)).Type().Elem(),
+	(*SendSolTx)(nil).messageType():                 reflect.ValueOf((*SendSolTx)(nil)).Type().Elem(),
+	(*SendSolTxResponse)(nil).messageType():         reflect.ValueOf((*SendSolTxResponse)(nil)).Type().Elem(),
+	(*SignResponse)(nil).messageType():              reflect.ValueOf((*SignResponse)(nil)).Type().Elem(),
+	(*FundingError)(nil).messageType():              reflect.ValueOf((*FundingError)(nil)).Type().Elem(),
+	(*OrderBookSnapshot)(nil).messageType():         reflect.ValueOf((*OrderBookSnapshot)(nil)).Type().Elem(),
+	(*OrderBookDelta)(nil).messageType():            reflect.ValueOf((*OrderBookDelta)(nil)).Type().Elem(),
+	(*ResyncRequired)(nil).messageType():            reflect.ValueOf((*ResyncRequired)(nil)).Type().Elem(),
+	(*Trade)(nil).messageType():                     reflect.ValueOf((*Trade)(nil)).Type().Elem(),
+	(*Subscribe)(nil).messageType():                 reflect.ValueOf((*Subscribe)(nil)).Type().Elem(),
+	(*Unsubscribe)(nil).messageType():               reflect.ValueOf((*Unsubscribe)(nil)).Type().Elem(),
+	(*Subscribed)(nil).messageType():                reflect.ValueOf((*Subscribed)(nil)).Type().Elem(),
+	(*Unsubscribed)(nil).messageType():              reflect.ValueOf((*Unsubscribed)(nil)).Type().Elem(),
+	(*StreamFrame)(nil).messageType():               reflect.ValueOf((*StreamFrame)(nil)).Type().Elem(),
+	(*CreateOrder)(nil).messageType():               reflect.ValueOf((*CreateOrder)(nil)).Type().Elem(),
+	(*CreateOrderAck)(nil).messageType():            reflect.ValueOf((*CreateOrderAck)(nil)).Type().Elem(),
+	(*CancelOrder)(nil).messageType():               reflect.ValueOf((*CancelOrder)(nil)).Type().Elem(),
+	(*CancelOrderAck)(nil).messageType():            reflect.ValueOf((*CancelOrderAck)(nil)).Type().Elem(),
+	(*ReplaceOrder)(nil).messageType():              reflect.ValueOf((*ReplaceOrder)(nil)).Type().Elem(),
+	(*ReplaceOrderAck)(nil).messageType():           reflect.ValueOf((*ReplaceOrderAck)(nil)).Type().Elem(),
+	(*AcceptOrder)(nil).messageType():               reflect.ValueOf((*AcceptOrder)(nil)).Type().Elem(),
+	(*AcceptOrderAck)(nil).messageType():            reflect.ValueOf((*AcceptOrderAck)(nil)).Type().Elem(),
+	(*GetOrderBook)(nil).messageType():              reflect.ValueOf((*GetOrderBook)(nil)).Type().Elem(),
+	(*GetOrderBookResponse)(nil).messageType():      reflect.ValueOf((*GetOrderBookResponse)(nil)).Type().Elem(),
+	(*OrderBookDepth)(nil).messageType():            reflect.ValueOf((*OrderBookDepth)(nil)).Type().Elem(),
+	(*OrderBookDepthDelta)(nil).messageType():       reflect.ValueOf((*OrderBookDepthDelta)(nil)).Type().Elem(),
+	(*GetDepth)(nil).messageType():                  reflect.ValueOf((*GetDepth)(nil)).Type().Elem(),
+	(*GetDepthResponse)(nil).messageType():          reflect.ValueOf((*GetDepthResponse)(nil)).Type().Elem(),
+	(*GetTrades)(nil).messageType():                 reflect.ValueOf((*GetTrades)(nil)).Type().Elem(),
+	(*GetTradesResponse)(nil).messageType():         reflect.ValueOf((*GetTradesResponse)(nil)).Type().Elem(),
+	(*GetCandles)(nil).messageType():                reflect.ValueOf((*GetCandles)(nil)).Type().Elem(),
+	(*GetCandlesResponse)(nil).messageType():        reflect.ValueOf((*GetCandlesResponse)(nil)).Type().Elem(),
+	(*EnableConsolidatedBook)(nil).messageType():    reflect.ValueOf((*EnableConsolidatedBook)(nil)).Type().Elem(),
+	(*ConsolidatedBookEnabled)(nil).messageType():   reflect.ValueOf((*ConsolidatedBookEnabled)(nil)).Type().Elem(),
+	(*SetAuctionMode)(nil).messageType():            reflect.ValueOf((*SetAuctionMode)(nil)).Type().Elem(),
+	(*SetAuctionModeAck)(nil).messageType():         reflect.ValueOf((*SetAuctionModeAck)(nil)).Type().Elem(),
+	(*GetStreamToken)(nil).messageType():            reflect.ValueOf((*GetStreamToken)(nil)).Type().Elem(),
+	(*StreamToken)(nil).messageType():               reflect.ValueOf((*StreamToken)(nil)).Type().Elem(),
+	(*SetOrderBookVisibility)(nil).messageType():    reflect.ValueOf((*SetOrderBookVisibility)(nil)).Type().Elem(),
+	(*SetOrderBookVisibilityAck)(nil).messageType(): reflect.ValueOf((*SetOrderBookVisibilityAck)(nil)).Type().Elem(),
+	(*SetCancelOnDisconnect)(nil).messageType():     reflect.ValueOf((*SetCancelOnDisconnect)(nil)).Type().Elem(),
+	(*SetCancelOnDisconnectAck)(nil).messageType():  reflect.ValueOf((*SetCancelOnDisconnectAck)(nil)).Type().Elem(),
+	(*Error)(nil).messageType():                     reflect.ValueOf((*Error)(nil)).Type().Elem(),
+	(*Success)(nil).messageType():                   reflect.ValueOf((*Success)(nil)).Type().Elem(),
+	(*MockMessage)(nil).messageType():               reflect.ValueOf((*MockMessage)(nil)).Type().Elem(),
 }
 
-func (*Request) messageType() string                 { return "Request" }
-func (*Response) messageType() string                { return "Response" }
-func (*EthereumInitialize) messageType() string      { return "EthereumInitialize" }
-func (*SolanaInitialize) messageType() string        { return "SolanaInitialize" }
-func (*CrossContractInitialize) messageType() string { return "CrossContractInitialize" }
-func (*Initialized) messageType() string             { return "Initialized" }
-func (*GetChains) messageType() string               { return "GetChains" }
-func (*GetChainsResponse) messageType() string       { return "GetChainsResponse" }
-func (*GetAssets) messageType() string               { return "GetAssets" }
-func (*GetAssetsResponse) messageType() string       { return "GetAssetsResponse" }
-func (*GetDecimals) messageType() string             { return "GetDecimals" }
-func (*GetDecimalsResponse) messageType() string     { return "GetDecimalsResponse" }
-func (*GetTimeout) messageType() string              { return "GetTimeout" }
-func (*GetTimeoutResponse) messageType() string      { return "GetTimeoutResponse" }
-func (*GetQuote) messageType() string                { return "GetQuote" }
-func (*GetQuoteResponse) messageType() string        { return "GetQuoteResponse" }
-func (*GetFunds) messageType() string                { return "GetFunds" }
-func (*GetFundsResponse) messageType() string        { return "GetFundsResponse" }
-func (*GetBalance) messageType() string              { return "GetBalance" }
-func (*GetHubBalance) messageType() string           { return "GetHubBalance" }
-func (*GetBalanceResponse) messageType() string      { return "GetBalanceResponse" }
-func (*OpenChannel) messageType() string             { return "OpenChannel" }
-func (*UpdateChannel) messageType() string           { return "UpdateChannel" }
-func (*ChannelProposal) messageType() string         { return "ChannelProposal" }
-func (*ProposalResponse) messageType() string        { return "ProposalResponse" }
-func (*ChannelCreated) messageType() string          { return "ChannelCreated" }
-func (*CloseChannel) messageType() string            { return "CloseChannel" }
-func (*ChannelClosed) messageType() string           { return "ChannelClosed" }
-func (*GetChannelInfo) messageType() string          { return "GetChannelInfo" }
-func (*ChannelInfo) messageType() string             { return "ChannelInfo" }
-func (*GetSignedState) messageType() string          { return "GetSignedState" }
-func (*SignedState) messageType() string             { return "SignedState" }
-func (*SignETHData) messageType() string             { return "SignETHData" }
-func (*SignSolData) messageType() string             { return "SignSolData" }
-func (*SendETHTx) messageType() string               { return "SendETHTx" }
-func (*SendETHTxResponse) messageType() string       { return "SendETHTxResponse" }
-func (*SendSolTx) messageType() string               { return "SendSolTx" }
-func (*SendSolTxResponse) messageType() string       { return "SendSolTxResponse" }
-func (*SignResponse) messageType() string            { return "SignResponse" }
-func (*Success) messageType() string                 { return "Success" }
-func (*OrderBookSnapshot) messageType() string       { return "OrderBookSnapshot" }
-func (*OrderBookDelta) messageType() string          { return "OrderBookDelta" }
-func (*CreateOrder) messageType() string             { return "CreateOrder" }
-func (*CreateOrderAck) messageType() string          { return "CreateOrderAck" }
-func (*CancelOrder) messageType() string             { return "CancelOrder" }
-func (*CancelOrderAck) messageType() string          { return "CancelOrderAck" }
-func (*AcceptOrder) messageType() string             { return "AcceptOrder" }
-func (*AcceptOrderAck) messageType() string          { return "AcceptOrderAck" }
-func (*GetOrderBook) messageType() string            { return "GetOrderBook" }
-func (*GetOrderBookResponse) messageType() string    { return "GetOrderBookResponse" }
-func (*FundingError) messageType() string            { return "FundingError" }
-func (*Error) messageType() string                   { return "Error" }
-func (*MockMessage) messageType() string             { return "MockMessage" }
-func (*SendSignedState) messageType() string         { return "SendSignedState" }
+func (*Request) messageType() string                   { return "Request" }
+func (*Response) messageType() string                  { return "Response" }
+func (*EthereumInitialize) messageType() string        { return "EthereumInitialize" }
+func (*SolanaInitialize) messageType() string          { return "SolanaInitialize" }
+func (*CrossContractInitialize) messageType() string   { return "CrossContractInitialize" }
+func (*AuthChallenge) messageType() string             { return "AuthChallenge" }
+func (*AuthResponse) messageType() string              { return "AuthResponse" }
+func (*Initialized) messageType() string               { return "Initialized" }
+func (*GetChains) messageType() string                 { return "GetChains" }
+func (*GetChainsResponse) messageType() string         { return "GetChainsResponse" }
+func (*GetAssets) messageType() string                 { return "GetAssets" }
+func (*GetAssetsResponse) messageType() string         { return "GetAssetsResponse" }
+func (*GetDecimals) messageType() string               { return "GetDecimals" }
+func (*GetDecimalsResponse) messageType() string       { return "GetDecimalsResponse" }
+func (*GetTimeout) messageType() string                { return "GetTimeout" }
+func (*GetTimeoutResponse) messageType() string        { return "GetTimeoutResponse" }
+func (*GetQuote) messageType() string                  { return "GetQuote" }
+func (*GetQuoteResponse) messageType() string          { return "GetQuoteResponse" }
+func (*GetFunds) messageType() string                  { return "GetFunds" }
+func (*GetFundsResponse) messageType() string          { return "GetFundsResponse" }
+func (*GetBalance) messageType() string                { return "GetBalance" }
+func (*GetHubBalance) messageType() string             { return "GetHubBalance" }
+func (*GetBalanceResponse) messageType() string        { return "GetBalanceResponse" }
+func (*OpenChannel) messageType() string               { return "OpenChannel" }
+func (*UpdateChannel) messageType() string             { return "UpdateChannel" }
+func (*ChannelProposal) messageType() string           { return "ChannelProposal" }
+func (*ProposalResponse) messageType() string          { return "ProposalResponse" }
+func (*ChannelCreated) messageType() string            { return "ChannelCreated" }
+func (*CloseChannel) messageType() string              { return "CloseChannel" }
+func (*ChannelClosed) messageType() string             { return "ChannelClosed" }
+func (*GetChannelInfo) messageType() string            { return "GetChannelInfo" }
+func (*ChannelInfo) messageType() string               { return "ChannelInfo" }
+func (*GetSignedState) messageType() string            { return "GetSignedState" }
+func (*SignedState) messageType() string               { return "SignedState" }
+func (*SignETHData) messageType() string               { return "SignETHData" }
+func (*SignSolData) messageType() string               { return "SignSolData" }
+func (*SendETHTx) messageType() string                 { return "SendETHTx" }
+func (*SendETHTxResponse) messageType() string         { return "SendETHTxResponse" }
+func (*SendSolTx) messageType() string                 { return "SendSolTx" }
+func (*SendSolTxResponse) messageType() string         { return "SendSolTxResponse" }
+func (*SignResponse) messageType() string              { return "SignResponse" }
+func (*Success) messageType() string                   { return "Success" }
+func (*OrderBookSnapshot) messageType() string         { return "OrderBookSnapshot" }
+func (*OrderBookDelta) messageType() string            { return "OrderBookDelta" }
+func (*ResyncRequired) messageType() string            { return "ResyncRequired" }
+func (*Trade) messageType() string                     { return "Trade" }
+func (*Subscribe) messageType() string                 { return "Subscribe" }
+func (*Unsubscribe) messageType() string               { return "Unsubscribe" }
+func (*Subscribed) messageType() string                { return "Subscribed" }
+func (*Unsubscribed) messageType() string              { return "Unsubscribed" }
+func (*StreamFrame) messageType() string               { return "StreamFrame" }
+func (*CreateOrder) messageType() string               { return "CreateOrder" }
+func (*CreateOrderAck) messageType() string            { return "CreateOrderAck" }
+func (*CancelOrder) messageType() string               { return "CancelOrder" }
+func (*CancelOrderAck) messageType() string            { return "CancelOrderAck" }
+func (*ReplaceOrder) messageType() string              { return "ReplaceOrder" }
+func (*ReplaceOrderAck) messageType() string           { return "ReplaceOrderAck" }
+func (*AcceptOrder) messageType() string               { return "AcceptOrder" }
+func (*AcceptOrderAck) messageType() string            { return "AcceptOrderAck" }
+func (*GetOrderBook) messageType() string              { return "GetOrderBook" }
+func (*GetOrderBookResponse) messageType() string      { return "GetOrderBookResponse" }
+func (*OrderBookDepth) messageType() string            { return "OrderBookDepth" }
+func (*OrderBookDepthDelta) messageType() string       { return "OrderBookDepthDelta" }
+func (*GetDepth) messageType() string                  { return "GetDepth" }
+func (*GetDepthResponse) messageType() string          { return "GetDepthResponse" }
+func (*GetTrades) messageType() string                 { return "GetTrades" }
+func (*GetTradesResponse) messageType() string         { return "GetTradesResponse" }
+func (*GetCandles) messageType() string                { return "GetCandles" }
+func (*GetCandlesResponse) messageType() string        { return "GetCandlesResponse" }
+func (*EnableConsolidatedBook) messageType() string    { return "EnableConsolidatedBook" }
+func (*ConsolidatedBookEnabled) messageType() string   { return "ConsolidatedBookEnabled" }
+func (*SetAuctionMode) messageType() string            { return "SetAuctionMode" }
+func (*SetAuctionModeAck) messageType() string         { return "SetAuctionModeAck" }
+func (*GetStreamToken) messageType() string            { return "GetStreamToken" }
+func (*StreamToken) messageType() string               { return "StreamToken" }
+func (*SetOrderBookVisibility) messageType() string    { return "SetOrderBookVisibility" }
+func (*SetOrderBookVisibilityAck) messageType() string { return "SetOrderBookVisibilityAck" }
+func (*SetCancelOnDisconnect) messageType() string     { return "SetCancelOnDisconnect" }
+func (*SetCancelOnDisconnectAck) messageType() string  { return "SetCancelOnDisconnectAck" }
+func (*FundingError) messageType() string              { return "FundingError" }
+func (*Error) messageType() string                     { return "Error" }
+func (*MockMessage) messageType() string               { return "MockMessage" }
+func (*SendSignedState) messageType() string           { return "SendSignedState" }
 
 // NewRequest creates a new Request with the given ID and Message.
 func NewRequest(ID uint64, msg Message) *Request {
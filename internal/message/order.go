@@ -1,6 +1,12 @@
 package message
 
-import "perun.network/go-perun/channel"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"perun.network/go-perun/channel"
+)
 
 // OrderSide represents bid or ask for an order.
 type OrderSide string
@@ -19,18 +25,89 @@ const (
 	OrderCanceled OrderStatus = "canceled"
 	OrderRejected OrderStatus = "rejected"
 	OrderFilled   OrderStatus = "filled"
+	OrderExpired  OrderStatus = "expired"
+	// OrderPending is a stop order that waits for its trigger price and is
+	// not yet visible in the book.
+	OrderPending OrderStatus = "pending"
+)
+
+// OrderType selects how the price of an order is determined.
+type OrderType string
+
+const (
+	// OrderLimit trades at the order's price or better. It is the default.
+	OrderLimit OrderType = "limit"
+	// OrderMarket has no price and trades against whatever the opposite side
+	// offers. It never rests in the book.
+	OrderMarket OrderType = "market"
+	// OrderStop is a market order that is held back until the last trade
+	// price reaches StopPrice: at or above it for bids, at or below it for
+	// asks.
+	OrderStop OrderType = "stop"
+	// OrderStopLimit is a limit order at Price that is held back like
+	// OrderStop.
+	OrderStopLimit OrderType = "stopLimit"
+)
+
+// TimeInForce selects how long an order stays in the book.
+type TimeInForce string
+
+const (
+	// TimeGTC rests until the order is filled or canceled. It is the default.
+	TimeGTC TimeInForce = "GTC"
+	// TimeGTT rests until ExpiresAt.
+	TimeGTT TimeInForce = "GTT"
+	// TimeIOC fills what it can immediately and cancels the rest.
+	TimeIOC TimeInForce = "IOC"
+	// TimeFOK fills completely and immediately or is rejected.
+	TimeFOK TimeInForce = "FOK"
+)
+
+// SelfTradeMode selects what happens when an incoming order would match a
+// resting order of the same trader.
+type SelfTradeMode string
+
+const (
+	// SelfTradeCancelNewest cancels the rest of the incoming order and keeps
+	// the resting one. It is the default.
+	SelfTradeCancelNewest SelfTradeMode = "cancelNewest"
+	// SelfTradeCancelOldest cancels the resting order and lets the incoming
+	// order continue matching.
+	SelfTradeCancelOldest SelfTradeMode = "cancelOldest"
+	// SelfTradeCancelBoth cancels the resting order and the rest of the
+	// incoming order.
+	SelfTradeCancelBoth SelfTradeMode = "cancelBoth"
+)
+
+// RemoveReason explains why an order left the book.
+type RemoveReason string
+
+const (
+	RemoveFilled   RemoveReason = "filled"
+	RemoveCanceled RemoveReason = "canceled"
+	RemoveExpired  RemoveReason = "expired"
+	// RemoveChannelFinal is an order canceled because the state of its
+	// channel became final.
+	RemoveChannelFinal RemoveReason = "channelFinal"
+	// RemoveDisconnected is an order canceled because its maker disconnected
+	// with cancel-on-disconnect enabled.
+	RemoveDisconnected RemoveReason = "disconnected"
+	// RemoveSelfTrade is a resting order canceled by the self-trade
+	// prevention of an incoming order of the same trader.
+	RemoveSelfTrade RemoveReason = "selfTrade"
 )
 
 // OrderID is the unique identifier of an off-chain order.
 type OrderID string
 
 // Order describes a limit order proposal for a Perun ledger channel.
-// Amounts are strings in base units of the base asset; price is quoted as
-// a rational on-chain price in quote/base, represented as a decimal string.
+// Amounts are decimal strings in units of the base asset; price is quoted as
+// a rational price in quote/base, represented as a decimal string. Both are
+// scaled by the assets' decimals when a fill is settled in the channel.
 type Order struct {
-	ID        OrderID       `json:"id"`
+	ID        OrderID       `json:"id"` // assigned by the server
 	ChannelID channel.ID    `json:"channelID"`
-	MakerIdx  channel.Index `json:"makerIdx"`  // who created it, 0/1
+	MakerIdx  channel.Index `json:"makerIdx"`  // who created it, 0/1, set by the server
 	Side      OrderSide     `json:"side"`      // "bid" or "ask"
 	Base      Asset         `json:"base"`      // asset being bought/sold
 	Quote     Asset         `json:"quote"`     // pricing asset
@@ -39,7 +116,118 @@ type Order struct {
 	Status    OrderStatus   `json:"status"`    // lifecycle status
 	CreatedAt int64         `json:"createdAt"` // unix seconds
 	ExpiresAt *int64        `json:"expiresAt,omitempty"`
-	ClientTag string        `json:"clientTag,omitempty"` // optional client tag
+	ClientTag string        `json:"clientTag,omitempty"` // optional reference chosen by the maker
+	Remaining string        `json:"remaining,omitempty"` // unfilled base units, set by the book
+	Filled    string        `json:"filled,omitempty"`    // filled base units, set by the book
+	// Type defaults to OrderLimit and TimeInForce to TimeGTC. An ExpiresAt
+	// is honored for all resting orders; GTT requires it.
+	Type        OrderType   `json:"type,omitempty"`
+	TimeInForce TimeInForce `json:"timeInForce,omitempty"`
+	// PostOnly orders are rejected if they would trade on arrival.
+	PostOnly bool `json:"postOnly,omitempty"`
+	// StopPrice is the trigger price of stop and stop-limit orders.
+	StopPrice string `json:"stopPrice,omitempty"`
+	// SelfTradePrevention applies when the order would match an order of
+	// the same trader and defaults to SelfTradeCancelNewest.
+	SelfTradePrevention SelfTradeMode `json:"selfTradePrevention,omitempty"`
+	// Trader is the maker's L2 address, set by the server. It identifies
+	// the orders of a trader across its channels.
+	Trader string `json:"trader,omitempty"`
+	// Nonce distinguishes otherwise identical orders of the same maker.
+	Nonce uint64 `json:"nonce"`
+	// Signature is the maker's L2 signature over SigningData.
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// orderDomain separates order signatures from other data signed with the
+// same key.
+const orderDomain = "PerunDEXOrder/v1"
+
+// SigningData returns the canonical encoding of the order that the maker
+// signs. It covers the domain, channel ID, nonce, maker index, side, base and
+// quote asset, price, amount, expiry, type, time in force, the post-only
+// flag and the stop price. Integers are big-endian, strings are prefixed with their length as
+// uint32, assets are encoded as "<assetType>:<code>", a missing expiry as 0
+// and the flag as a single byte. Fields set by the book, like ID and status,
+// are not covered.
+func (o Order) SigningData() ([]byte, error) {
+	if o.Base == nil || o.Quote == nil {
+		return nil, errors.New("missing base or quote asset")
+	}
+	var expiry int64
+	if o.ExpiresAt != nil {
+		expiry = *o.ExpiresAt
+	}
+
+	var buf bytes.Buffer
+	writeString := func(s string) {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+	writeString(orderDomain)
+	buf.Write(o.ChannelID[:])
+	_ = binary.Write(&buf, binary.BigEndian, o.Nonce)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(o.MakerIdx))
+	writeString(string(o.Side))
+	writeString(o.Base.AssetType() + ":" + o.Base.Code())
+	writeString(o.Quote.AssetType() + ":" + o.Quote.Code())
+	writeString(o.Price)
+	writeString(o.Amount)
+	_ = binary.Write(&buf, binary.BigEndian, expiry)
+	writeString(string(o.Type))
+	writeString(string(o.TimeInForce))
+	if o.PostOnly {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	writeString(o.StopPrice)
+	return buf.Bytes(), nil
+}
+
+// Trade records a match between a resting maker order and an incoming taker
+// order. Price is always the maker's price. In a hub's consolidated book the
+// trade is settled in the maker's channel ChannelID and in the taker's channel
+// TakerChannelID, each with the hub as counterparty.
+type Trade struct {
+	ChannelID    channel.ID `json:"channelID"`
+	Sequence     uint64     `json:"sequence"` // position in the book's trade log
+	Market       string     `json:"market"`   // base/quote pair
+	MakerOrderID OrderID    `json:"makerOrderID"`
+	TakerOrderID OrderID    `json:"takerOrderID"`
+	TakerSide    OrderSide  `json:"takerSide"`
+	Price        string     `json:"price"`     // decimal string
+	Amount       string     `json:"amount"`    // base units
+	Version      uint64     `json:"version"`   // channel state version that settled the trade
+	Timestamp    int64      `json:"timestamp"` // unix seconds
+
+	TakerChannelID *channel.ID `json:"takerChannelID,omitempty"`
+	TakerVersion   uint64      `json:"takerVersion,omitempty"`
+
+	// MakerFee and TakerFee are the fees deducted in the settling updates in
+	// whole units of the asset the respective party received: the base
+	// asset for the buyer and the quote asset for the seller.
+	MakerFee string `json:"makerFee,omitempty"`
+	TakerFee string `json:"takerFee,omitempty"`
+
+	// Unbalanced marks a trade of a consolidated book of which only the
+	// taker's update was settled: the maker's channel rejected its update
+	// and undoing the taker's update failed, so the hub holds an open
+	// position. Version is then the unchanged version of the maker's channel.
+	Unbalanced bool `json:"unbalanced,omitempty"`
+}
+
+// Candle aggregates the trades of one market in the interval starting at
+// Start into open, high, low and close prices and the traded volume.
+type Candle struct {
+	Start       int64  `json:"start"` // unix seconds
+	Open        string `json:"open"`
+	High        string `json:"high"`
+	Low         string `json:"low"`
+	Close       string `json:"close"`
+	Volume      string `json:"volume"`      // base units
+	QuoteVolume string `json:"quoteVolume"` // quote units
+	Trades      int    `json:"trades"`
 }
 
 // OrderBookSnapshot provides a full view of current active orders for a channel.
@@ -60,4 +248,72 @@ type OrderBookDelta struct {
 	Updated   []Order   `json:"updated"`
 	Removed   []OrderID `json:"removed"`
 	TotalOpen uint64    `json:"totalOpen"` // after applying this delta
+	// Reasons maps each removed order ID to why it left the book.
+	Reasons map[OrderID]RemoveReason `json:"reasons,omitempty"`
+	// Auctions are the batch auctions whose result the delta carries.
+	Auctions []AuctionClearing `json:"auctions,omitempty"`
+}
+
+// AuctionClearing is the result of a batch auction in one market: all of its
+// trades executed at Price, and Volume is the base amount that was settled.
+type AuctionClearing struct {
+	Market string `json:"market"`
+	Price  string `json:"price"`
+	Volume string `json:"volume"`
+}
+
+// ResyncRequired tells a stream subscriber that it fell behind and deltas after
+// Sequence were dropped. The stream continues with a fresh view of the book,
+// which replaces the subscriber's local copy.
+type ResyncRequired struct {
+	ChannelID channel.ID `json:"channelID"`
+	Sequence  uint64     `json:"sequence"` // last sequence delivered
+}
+
+// StreamTopic selects what a subscriber of the multiplexed order book stream
+// receives about a book.
+type StreamTopic string
+
+// Stream topics.
+const (
+	// TopicBook streams the snapshot and deltas of all orders.
+	TopicBook StreamTopic = "book"
+	// TopicDepth streams the aggregated price levels.
+	TopicDepth StreamTopic = "depth"
+	// TopicTrades streams the trades as they are settled.
+	TopicTrades StreamTopic = "trades"
+)
+
+// PriceLevel aggregates the open orders of one side of a market at the same
+// price.
+type PriceLevel struct {
+	Price  string `json:"price"`  // decimal string
+	Amount string `json:"amount"` // summed remaining base units
+	Orders int    `json:"orders"` // number of orders at this price
+}
+
+// MarketDepth lists the best price levels of a single base/quote pair. Market
+// is "<assetType>:<code>/<assetType>:<code>" of the base and quote asset.
+type MarketDepth struct {
+	Market string       `json:"market"`
+	Bids   []PriceLevel `json:"bids"` // highest price first
+	Asks   []PriceLevel `json:"asks"` // lowest price first
+}
+
+// OrderBookDepth is an aggregated view of the top Levels price levels per
+// side of every market in a channel's book.
+type OrderBookDepth struct {
+	ChannelID channel.ID    `json:"channelID"`
+	Sequence  uint64        `json:"sequence"` // book sequence the depth reflects
+	Levels    int           `json:"levels"`
+	Markets   []MarketDepth `json:"markets"`
+}
+
+// OrderBookDepthDelta lists the price levels that changed since the previous
+// depth frame with their new totals. A level with zero orders left the top
+// levels and is to be dropped.
+type OrderBookDepthDelta struct {
+	ChannelID channel.ID    `json:"channelID"`
+	Sequence  uint64        `json:"sequence"`
+	Markets   []MarketDepth `json:"markets"`
 }
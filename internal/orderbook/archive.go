@@ -0,0 +1,70 @@
+package orderbook
+
+import (
+	"container/list"
+	"sync"
+
+	"perun.network/go-perun/channel"
+)
+
+// ArchiveCacheSize is the number of archived books a persisted engine keeps in
+// memory after reading them from the archive directory.
+const ArchiveCacheSize = 64
+
+// archiveCache keeps the most recently queried archived books, so that
+// queries of closed channels do not read and replay their books every time.
+// The books are read-only and shared by all queries.
+type archiveCache struct {
+	mu    sync.Mutex
+	size  int
+	lru   *list.List // of *Book, most recently used first
+	books map[channel.ID]*list.Element
+}
+
+func newArchiveCache(size int) *archiveCache {
+	return &archiveCache{
+		size:  size,
+		lru:   list.New(),
+		books: make(map[channel.ID]*list.Element),
+	}
+}
+
+// get returns the cached book of the channel or the one returned by load,
+// which is called without holding the cache's lock. Books that fail to load
+// are not cached. The least recently used book is evicted once the cache is
+// full.
+func (c *archiveCache) get(chID channel.ID, load func(channel.ID) (*Book, error)) (*Book, error) {
+	if b, ok := c.lookup(chID); ok {
+		return b, nil
+	}
+	b, err := load(chID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Another query may have loaded the book meanwhile.
+	if el, ok := c.books[chID]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*Book), nil
+	}
+	c.books[chID] = c.lru.PushFront(b)
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.books, oldest.Value.(*Book).chID)
+	}
+	return b, nil
+}
+
+func (c *archiveCache) lookup(chID channel.ID) (*Book, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.books[chID]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*Book), true
+}
@@ -0,0 +1,352 @@
+package orderbook
+
+import (
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+)
+
+// AuctionTick is the default interval in which the engine checks whether
+// books in auction mode are due for clearing.
+const AuctionTick = 100 * time.Millisecond
+
+// auctionBatch collects the changes of the fills of a batch auction, which
+// are broadcast as a single delta once all of them are settled.
+type auctionBatch struct {
+	pending   int
+	delta     message.OrderBookDelta
+	clearings []message.AuctionClearing
+	// volumes are the settled base amounts per market.
+	volumes map[string]*big.Rat
+}
+
+// commit adds the changes of a settled fill to the batch.
+func (a *auctionBatch) commit(market string, amount *big.Rat, d message.OrderBookDelta) {
+	v, ok := a.volumes[market]
+	if !ok {
+		v = new(big.Rat)
+		a.volumes[market] = v
+	}
+	v.Add(v, amount)
+	a.merge(d)
+}
+
+// abort adds the changes of a failed fill to the batch.
+func (a *auctionBatch) abort(d message.OrderBookDelta) {
+	a.merge(d)
+}
+
+func (a *auctionBatch) merge(d message.OrderBookDelta) {
+	a.delta.Updated = append(a.delta.Updated, d.Updated...)
+	a.delta.Removed = append(a.delta.Removed, d.Removed...)
+	for id, reason := range d.Reasons {
+		if a.delta.Reasons == nil {
+			a.delta.Reasons = make(map[message.OrderID]message.RemoveReason)
+		}
+		a.delta.Reasons[id] = reason
+	}
+}
+
+// RunAuctions clears the books in auction mode whenever their interval has
+// passed, checking every tick until the engine is closed. The fills of each
+// auction are handed to settle, which must pass every fill to CommitFill or
+// AbortFill. A book does not clear again before its last auction is settled.
+func (e *Engine) RunAuctions(tick time.Duration, settle func(*Book, []*Fill)) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, b := range e.allBooks() {
+				if fills := b.auction(now.Unix()); len(fills) > 0 {
+					go settle(b, fills)
+				}
+			}
+		case <-e.closed:
+			return
+		}
+	}
+}
+
+// SetAuctionInterval switches the book to frequent batch auctions that clear
+// every interval seconds, or back to continuous matching if interval is 0.
+// Auctions take place at multiples of the interval since the unix epoch.
+// Switching back clears the orders collected so far in a last auction whose
+// fills are returned for settlement. It returns the reason for refusing the
+// switch, or "".
+func (b *Book) SetAuctionInterval(interval int64) ([]*Fill, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case interval < 0:
+		return nil, "invalid interval"
+	case b.closed:
+		return nil, "channel is closed"
+	case b.batch != nil:
+		return nil, "an auction is being settled"
+	case interval > 0 && len(b.stops) > 0:
+		return nil, "book has waiting stop orders"
+	}
+
+	var fills []*Fill
+	if interval == 0 && b.settings.AuctionInterval > 0 {
+		fills = b.clearAuction()
+	}
+	b.settings.AuctionInterval = interval
+	b.nextAuction = 0
+	b.saveSettings()
+	return fills, ""
+}
+
+// auctionMode reports whether the book clears in batch auctions. Must be
+// called with b.mu held.
+func (b *Book) auctionMode() bool {
+	return b.settings.AuctionInterval > 0
+}
+
+// auction clears the book if it is in auction mode and the auction is due at
+// the unix time now.
+func (b *Book) auction(now int64) []*Fill {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.auctionMode() || b.closed || b.batch != nil || now < b.nextAuction {
+		return nil
+	}
+	interval := b.settings.AuctionInterval
+	b.nextAuction = now - now%interval + interval
+	return b.clearAuction()
+}
+
+// clearAuction matches the crossing orders of every market at the market's
+// clearing price. The matched amounts are reserved as fills of one batch.
+// Must be called with b.mu held.
+func (b *Book) clearAuction() []*Fill {
+	keys := make([]string, 0, len(b.markets))
+	for k := range b.markets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	now := time.Now().Unix()
+	batch := &auctionBatch{volumes: make(map[string]*big.Rat)}
+	var fills []*Fill
+	for _, key := range keys {
+		m := b.markets[key]
+		price, volume := b.clearingPrice(m, now)
+		if volume.Sign() == 0 {
+			continue
+		}
+		fills = append(fills, b.allocate(m, price, volume, now, batch)...)
+		batch.clearings = append(batch.clearings, message.AuctionClearing{
+			Market: key,
+			Price:  formatRat(price),
+		})
+	}
+	if len(fills) == 0 {
+		return nil
+	}
+	batch.pending = len(fills)
+	b.batch = batch
+	return fills
+}
+
+// clearingPrice returns the uniform price that maximizes the amount matched
+// in the market and that amount. Among prices with the same amount, the ones
+// that leave the smallest surplus of bids or asks are preferred, and if
+// several remain, the price halfway between the lowest and the highest of
+// them is used. Must be called with b.mu held.
+func (b *Book) clearingPrice(m *market, now int64) (price, volume *big.Rat) {
+	bids := b.levelAmounts(m.bids, now)
+	asks := b.levelAmounts(m.asks, now)
+
+	var candidates []*big.Rat
+	for _, l := range append(append([]levelAmount{}, bids...), asks...) {
+		candidates = append(candidates, l.price)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Cmp(candidates[j]) < 0 })
+
+	volume = new(big.Rat)
+	var lo, hi, bestImbalance *big.Rat
+	for _, p := range candidates {
+		demand, supply := new(big.Rat), new(big.Rat)
+		for _, l := range bids {
+			if l.price.Cmp(p) >= 0 {
+				demand.Add(demand, l.amount)
+			}
+		}
+		for _, l := range asks {
+			if l.price.Cmp(p) <= 0 {
+				supply.Add(supply, l.amount)
+			}
+		}
+		matched := minRat(demand, supply)
+		imbalance := new(big.Rat).Sub(demand, supply)
+		imbalance.Abs(imbalance)
+
+		switch c := matched.Cmp(volume); {
+		case matched.Sign() == 0:
+		case c > 0 || (c == 0 && imbalance.Cmp(bestImbalance) < 0):
+			volume, bestImbalance = new(big.Rat).Set(matched), imbalance
+			lo, hi = p, p
+		case c == 0 && imbalance.Cmp(bestImbalance) == 0:
+			hi = p
+		}
+	}
+	if volume.Sign() == 0 {
+		return nil, volume
+	}
+	price = new(big.Rat).Add(lo, hi)
+	return price.Quo(price, big.NewRat(2, 1)), volume
+}
+
+// levelAmount is the amount of a price level that can take part in an
+// auction.
+type levelAmount struct {
+	price, amount *big.Rat
+}
+
+// levelAmounts returns the matchable amounts of the side's price levels. Must
+// be called with b.mu held.
+func (b *Book) levelAmounts(s *bookSide, now int64) []levelAmount {
+	var levels []levelAmount
+	for _, lvl := range s.levels {
+		amount := new(big.Rat)
+		for _, o := range lvl.orders {
+			if b.matchable(o, now) {
+				amount.Add(amount, o.available())
+			}
+		}
+		if amount.Sign() > 0 {
+			levels = append(levels, levelAmount{price: lvl.price, amount: amount})
+		}
+	}
+	return levels
+}
+
+// matchable reports whether the order has an amount that can be matched at
+// the unix time now. Must be called with b.mu held.
+func (b *Book) matchable(o *bookOrder, now int64) bool {
+	return o.available().Sign() > 0 && !isExpired(o.order, now) && !b.withdrawn(o)
+}
+
+// allocation is the amount of an order matched in an auction.
+type allocation struct {
+	order *bookOrder
+	left  *big.Rat
+}
+
+// allocate matches volume of the bids at or above price with the asks at or
+// below it. Both sides are allocated in price-time priority, and each pair of
+// a bid and an ask becomes a fill in which the earlier order is the maker.
+// Admission keeps orders from crossing orders of their trader, but as they
+// can still meet here once the reservation of an earlier fill is released, a
+// self-trade pair is skipped along with the allocation of its later order.
+// Must be called with b.mu held.
+func (b *Book) allocate(m *market, price, volume *big.Rat, now int64, batch *auctionBatch) []*Fill {
+	bids := b.allocateSide(m.bids, func(p *big.Rat) bool { return p.Cmp(price) >= 0 }, volume, now)
+	asks := b.allocateSide(m.asks, func(p *big.Rat) bool { return p.Cmp(price) <= 0 }, volume, now)
+
+	var fills []*Fill
+	for i, j := 0, 0; i < len(bids) && j < len(asks); {
+		bid, ask := bids[i], asks[j]
+		maker, taker := ask.order, bid.order
+		if bid.order.order.CreatedAt < ask.order.order.CreatedAt {
+			maker, taker = bid.order, ask.order
+		}
+		if isSelfTrade(taker.order, maker.order) {
+			if taker == bid.order {
+				i++
+			} else {
+				j++
+			}
+			continue
+		}
+		qty := new(big.Rat).Set(minRat(bid.left, ask.left))
+		f := b.reserve(maker, qty, taker.order.ID, taker.order.ChannelID, taker.order.MakerIdx)
+		taker.reserved.Add(taker.reserved, qty)
+		f.taker = taker
+		f.Price, f.price = formatRat(price), price
+		f.batch = batch
+		fills = append(fills, f)
+
+		bid.left.Sub(bid.left, qty)
+		ask.left.Sub(ask.left, qty)
+		if bid.left.Sign() == 0 {
+			i++
+		}
+		if ask.left.Sign() == 0 {
+			j++
+		}
+	}
+	return fills
+}
+
+// allocateSide distributes volume over the matchable orders of the side whose
+// price level is within the clearing price, best first. Must be called with
+// b.mu held.
+func (b *Book) allocateSide(s *bookSide, within func(*big.Rat) bool, volume *big.Rat, now int64) []*allocation {
+	var allocs []*allocation
+	left := new(big.Rat).Set(volume)
+	for _, lvl := range s.levels {
+		if left.Sign() == 0 || !within(lvl.price) {
+			break
+		}
+		for _, o := range lvl.orders {
+			if left.Sign() == 0 {
+				break
+			}
+			if !b.matchable(o, now) {
+				continue
+			}
+			qty := new(big.Rat).Set(minRat(left, o.available()))
+			left.Sub(left, qty)
+			allocs = append(allocs, &allocation{order: o, left: qty})
+		}
+	}
+	return allocs
+}
+
+// finishFill counts a settled or failed fill of the batch and publishes the
+// auction's delta after the last one. Must be called with b.mu held.
+func (b *Book) finishFill(a *auctionBatch) {
+	a.pending--
+	if a.pending > 0 {
+		return
+	}
+	if b.batch == a {
+		b.batch = nil
+	}
+
+	// An order that was filled several times is listed once with its
+	// current row, or only as removed. Orders that were canceled, replaced
+	// or expired while the auction was settled already published these
+	// changes with their own delta and are not listed again, or only with
+	// their current row.
+	d := message.OrderBookDelta{Removed: a.delta.Removed, Reasons: a.delta.Reasons}
+	listed := make(map[message.OrderID]bool, len(a.delta.Updated)+len(d.Removed))
+	for _, id := range d.Removed {
+		listed[id] = true
+	}
+	for _, row := range a.delta.Updated {
+		o, ok := b.orders[row.ID]
+		if !ok || listed[row.ID] {
+			continue
+		}
+		listed[row.ID] = true
+		d.Updated = append(d.Updated, o.row())
+	}
+
+	for _, c := range a.clearings {
+		c.Volume = "0"
+		if v, ok := a.volumes[c.Market]; ok {
+			c.Volume = formatRat(v)
+		}
+		d.Auctions = append(d.Auctions, c)
+	}
+	b.publish(d)
+}
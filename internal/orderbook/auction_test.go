@@ -0,0 +1,218 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+// clearDue clears the auction of the book like its auction ticker would.
+func clearDue(b *Book) []*Fill {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.clearAuction()
+}
+
+func TestAuctionClearing(t *testing.T) {
+	tests := []struct {
+		name   string
+		orders []message.Order
+		price  string
+		volume string
+		fills  int
+		// left are the remaining amounts of the orders once the auction is
+		// settled, "" for removed orders.
+		left []string
+	}{
+		{
+			name:   "no cross",
+			orders: []message.Order{bid(0, "9", "1"), ask(1, "10", "1")},
+			left:   []string{"1", "1"},
+		},
+		{
+			name:   "midpoint of equal prices",
+			orders: []message.Order{bid(0, "11", "2"), ask(1, "9", "2")},
+			price:  "10",
+			volume: "2",
+			fills:  1,
+			left:   []string{"", ""},
+		},
+		{
+			name: "maximum volume",
+			orders: []message.Order{
+				bid(0, "12", "1"), bid(0, "11", "1"), bid(0, "10", "1"),
+				ask(1, "9", "1"), ask(1, "10", "1"), ask(1, "11", "2"),
+			},
+			price:  "10",
+			volume: "2",
+			fills:  2,
+			left:   []string{"", "", "1", "", "", "2"},
+		},
+		{
+			name:   "smallest surplus",
+			orders: []message.Order{bid(0, "10", "3"), ask(1, "9", "1"), ask(1, "10", "1")},
+			price:  "10",
+			volume: "2",
+			fills:  2,
+			left:   []string{"1", "", ""},
+		},
+		{
+			name:   "time priority within a level",
+			orders: []message.Order{bid(0, "10", "1"), bid(0, "10", "1"), ask(1, "10", "1")},
+			price:  "10",
+			volume: "1",
+			fills:  1,
+			left:   []string{"", "1", ""},
+		},
+		{
+			name:   "same maker does not trade",
+			orders: []message.Order{bid(0, "10", "1"), ask(0, "10", "1")},
+			left:   []string{"1", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			if _, reason := b.SetAuctionInterval(60); reason != "" {
+				t.Fatal(reason)
+			}
+			ids := make([]message.OrderID, len(tt.orders))
+			for i, o := range tt.orders {
+				ack, fills := submit(t, b, o)
+				if !ack.Accepted || len(fills) > 0 {
+					t.Fatalf("order %d: accepted %t (%s) with %d fills", i, ack.Accepted, ack.Reason, len(fills))
+				}
+				ids[i] = ack.ID
+			}
+			seq := b.Snapshot().Sequence
+
+			fills := clearDue(b)
+			if len(fills) != tt.fills {
+				t.Fatalf("got %d fills, want %d", len(fills), tt.fills)
+			}
+			for _, f := range fills {
+				if f.Price != tt.price {
+					t.Errorf("fill at %s, want %s", f.Price, tt.price)
+				}
+				b.CommitFill(f, Settlement{})
+			}
+			for i, id := range ids {
+				if got := remaining(b, id); got != tt.left[i] {
+					t.Errorf("order %d: remaining %q, want %q", i, got, tt.left[i])
+				}
+			}
+
+			deltas, _ := b.DeltasSince(seq)
+			if tt.fills == 0 {
+				if len(deltas) > 0 {
+					t.Errorf("published %d deltas without an auction", len(deltas))
+				}
+				return
+			}
+			if len(deltas) != 1 || len(deltas[0].Auctions) != 1 {
+				t.Fatalf("published %v, want one delta with the clearing", deltas)
+			}
+			if c := deltas[0].Auctions[0]; c.Price != tt.price || c.Volume != tt.volume {
+				t.Errorf("published clearing %s@%s, want %s@%s", c.Volume, c.Price, tt.volume, tt.price)
+			}
+		})
+	}
+}
+
+func TestAuctionBatchDelta(t *testing.T) {
+	tests := []struct {
+		name string
+		// abort aborts the second fill.
+		abort   bool
+		updated int
+		removed int
+		volume  string
+	}{
+		{name: "settled", updated: 0, removed: 3, volume: "2"},
+		{name: "second fill aborted", abort: true, updated: 1, removed: 1, volume: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			b.SetAuctionInterval(60)
+			createOrders(t, b, bid(0, "10", "1"), bid(0, "10", "1"), ask(1, "10", "2"))
+
+			fills := clearDue(b)
+			if len(fills) != 2 {
+				t.Fatalf("got %d fills, want 2", len(fills))
+			}
+			b.CommitFill(fills[0], Settlement{})
+			seq := b.Snapshot().Sequence
+			if tt.abort {
+				b.AbortFill(fills[1])
+			} else {
+				b.CommitFill(fills[1], Settlement{})
+			}
+
+			deltas, _ := b.DeltasSince(seq)
+			if len(deltas) != 1 {
+				t.Fatalf("published %d deltas, want 1", len(deltas))
+			}
+			d := deltas[0]
+			if len(d.Updated) != tt.updated || len(d.Removed) != tt.removed {
+				t.Errorf("delta updates %d and removes %d orders, want %d and %d",
+					len(d.Updated), len(d.Removed), tt.updated, tt.removed)
+			}
+			listed := make(map[message.OrderID]bool)
+			for _, row := range d.Updated {
+				if listed[row.ID] {
+					t.Errorf("order %s listed twice", row.ID)
+				}
+				listed[row.ID] = true
+			}
+			if len(d.Auctions) != 1 || d.Auctions[0].Volume != tt.volume {
+				t.Errorf("published clearings %v, want volume %s", d.Auctions, tt.volume)
+			}
+		})
+	}
+}
+
+func TestAuctionRestoreAfterPartialSettlement(t *testing.T) {
+	dir := t.TempDir()
+	e, err := OpenEngine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chID := channel.ID{1}
+	b := e.GetOrCreateBook(chID)
+	b.SetAuctionInterval(60)
+	ids := createOrders(t, b, bid(0, "10", "1"), bid(0, "10", "1"), ask(1, "10", "2"))
+	seq := b.Snapshot().Sequence
+
+	fills := clearDue(b)
+	if len(fills) != 2 {
+		t.Fatalf("got %d fills, want 2", len(fills))
+	}
+	// The first fill is settled, then the server stops before the second.
+	b.CommitFill(fills[0], Settlement{})
+	b.store.close()
+
+	e, err = OpenEngine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	b, _ = e.GetBook(chID)
+	for i, left := range []string{"", "1", "1"} {
+		if got := remaining(b, ids[i]); got != left {
+			t.Errorf("order %d: remaining %q, want %q", i, got, left)
+		}
+	}
+	if got := b.Snapshot().Sequence; got != seq {
+		t.Errorf("restored sequence %d, want %d", got, seq)
+	}
+
+	// The restored orders take part in the next auction.
+	fills = clearDue(b)
+	if len(fills) != 1 || formatRat(fills[0].Amount) != "1" {
+		t.Fatalf("next auction matched %v", fills)
+	}
+}
@@ -0,0 +1,136 @@
+package orderbook
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"github.com/pkg/errors"
+)
+
+// maxDecimalLen bounds the length of decimal strings in orders.
+const maxDecimalLen = 100
+
+// Decimals are the decimals of the base and quote asset of an order's market,
+// that is the number of fractional digits of one unit in the channel's
+// balances.
+type Decimals struct {
+	Base, Quote uint8
+}
+
+// ParseDecimal parses a non-negative decimal number in plain notation, such as
+// "12" or "0.015". Signs, exponents, fractions and surrounding whitespace are
+// rejected so that every accepted string denotes exactly one value.
+func ParseDecimal(s string) (*big.Rat, error) {
+	if s == "" {
+		return nil, errors.New("empty decimal")
+	}
+	if len(s) > maxDecimalLen {
+		return nil, errors.Errorf("decimal longer than %d characters", maxDecimalLen)
+	}
+	intPart, frac, hasFrac := strings.Cut(s, ".")
+	if intPart == "" || (hasFrac && frac == "") || !digitsOnly(intPart) || !digitsOnly(frac) {
+		return nil, errors.Errorf("invalid decimal %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, errors.Errorf("invalid decimal %q", s)
+	}
+	return r, nil
+}
+
+// FormatDecimal renders a non-negative r in the plain notation accepted by
+// ParseDecimal, without trailing zeros.
+func FormatDecimal(r *big.Rat) string {
+	return formatRat(r)
+}
+
+func digitsOnly(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePositive parses a decimal string and requires it to be greater than
+// zero.
+func parsePositive(s string) (*big.Rat, bool) {
+	r, err := ParseDecimal(s)
+	if err != nil || r.Sign() <= 0 {
+		return nil, false
+	}
+	return r, true
+}
+
+// decimalPlaces returns the number of significant fractional digits of a
+// decimal string accepted by ParseDecimal.
+func decimalPlaces(s string) int {
+	_, frac, _ := strings.Cut(s, ".")
+	return len(strings.TrimRight(frac, "0"))
+}
+
+// checkPrecision returns the reason for rejecting an order whose amount is
+// not a whole number of base units or whose prices have more fractional
+// digits than the quote asset, or "".
+func checkPrecision(o message.Order, d Decimals) string {
+	if decimalPlaces(o.Amount) > int(d.Base) {
+		return fmt.Sprintf("amount has more than %d decimals", d.Base)
+	}
+	if decimalPlaces(o.Price) > int(d.Quote) {
+		return fmt.Sprintf("price has more than %d decimals", d.Quote)
+	}
+	if decimalPlaces(o.StopPrice) > int(d.Quote) {
+		return fmt.Sprintf("stop price has more than %d decimals", d.Quote)
+	}
+	return ""
+}
+
+// BaseUnits converts an amount of whole units into the smallest units of an
+// asset with the given decimals. Amounts that are not a whole number of
+// smallest units are an error, as they cannot be transferred exactly.
+func BaseUnits(amount *big.Rat, decimals uint8) (*big.Int, error) {
+	scaled := new(big.Rat).Mul(amount, pow10(decimals))
+	if !scaled.IsInt() {
+		return nil, errors.Errorf("amount %s has more than %d decimals", formatRat(amount), decimals)
+	}
+	return new(big.Int).Set(scaled.Num()), nil
+}
+
+// QuoteUnits returns the quote amount of trading amount whole base units at
+// price in the smallest units of a quote asset with the given decimals. The
+// exact product is rounded down to the next smallest unit, so the buyer never
+// pays more than the price and the result does not depend on how the
+// amounts were written.
+func QuoteUnits(price, amount *big.Rat, decimals uint8) *big.Int {
+	scaled := new(big.Rat).Mul(price, amount)
+	scaled.Mul(scaled, pow10(decimals))
+	return new(big.Int).Quo(scaled.Num(), scaled.Denom())
+}
+
+// FillUnits returns the base and quote amounts in smallest units that a fill
+// of amount at the fill's price moves between the two parties. Both parties
+// of the channel compute the update with it, so they arrive at identical
+// balances. Fills whose quote amount rounds to zero are rejected.
+func FillUnits(fillPrice string, amount *big.Rat, d Decimals) (base, quote *big.Int, err error) {
+	price, err := ParseDecimal(fillPrice)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "fill price")
+	}
+	base, err = BaseUnits(amount, d.Base)
+	if err != nil {
+		return nil, nil, err
+	}
+	quote = QuoteUnits(price, amount, d.Quote)
+	if quote.Sign() == 0 {
+		return nil, nil, errors.Errorf("fill of %s is too small, its quote amount rounds to zero", formatRat(amount))
+	}
+	return base, quote, nil
+}
+
+// pow10 returns 10^n.
+func pow10(n uint8) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil))
+}
@@ -0,0 +1,115 @@
+package orderbook
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // formatted value, "" if rejected
+	}{
+		{"0", "0"},
+		{"12", "12"},
+		{"0.015", "0.015"},
+		{"1.500", "1.5"},
+		{"007", "7"},
+		{"", ""},
+		{"-1", ""},
+		{"+1", ""},
+		{"1e3", ""},
+		{"1/3", ""},
+		{".5", ""},
+		{"5.", ""},
+		{" 1", ""},
+		{"1.2.3", ""},
+		{strings.Repeat("1", maxDecimalLen), strings.Repeat("1", maxDecimalLen)},
+		{strings.Repeat("1", maxDecimalLen+1), ""},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseDecimal(tt.in)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseDecimal(%q) = %s, want error", tt.in, formatRat(r))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDecimal(%q): %v", tt.in, err)
+		} else if got := formatRat(r); got != tt.want {
+			t.Errorf("ParseDecimal(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFillUnits(t *testing.T) {
+	tests := []struct {
+		name   string
+		price  string
+		amount string
+		d      Decimals
+		base   string
+		quote  string
+		err    bool
+	}{
+		{name: "whole units", price: "2", amount: "3", d: Decimals{0, 0}, base: "3", quote: "6"},
+		{name: "scaled", price: "1.5", amount: "0.25", d: Decimals{9, 6}, base: "250000000", quote: "375000"},
+		{name: "quote rounds down", price: "0.333", amount: "1", d: Decimals{0, 2}, base: "1", quote: "33"},
+		{name: "rounding independent of notation", price: "0.3330", amount: "1.0", d: Decimals{0, 2}, base: "1", quote: "33"},
+		{name: "too many base decimals", price: "1", amount: "0.001", d: Decimals{2, 6}, err: true},
+		{name: "quote rounds to zero", price: "0.001", amount: "1", d: Decimals{0, 2}, err: true},
+		{name: "invalid price", price: "1e2", amount: "1", d: Decimals{0, 0}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, ok := new(big.Rat).SetString(tt.amount)
+			if !ok {
+				t.Fatalf("invalid amount %q", tt.amount)
+			}
+			base, quote, err := FillUnits(tt.price, amount, tt.d)
+			if tt.err {
+				if err == nil {
+					t.Errorf("got %s/%s, want error", base, quote)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if base.String() != tt.base || quote.String() != tt.quote {
+				t.Errorf("got %s/%s, want %s/%s", base, quote, tt.base, tt.quote)
+			}
+		})
+	}
+}
+
+func TestCheckPrecision(t *testing.T) {
+	d := Decimals{Base: 2, Quote: 3}
+	tests := []struct {
+		name      string
+		amount    string
+		price     string
+		stopPrice string
+		reason    string
+	}{
+		{name: "within decimals", amount: "1.25", price: "0.125"},
+		{name: "trailing zeros", amount: "1.2500", price: "0.1250000"},
+		{name: "amount", amount: "1.255", price: "1", reason: "amount has more than 2 decimals"},
+		{name: "price", amount: "1", price: "0.1255", reason: "price has more than 3 decimals"},
+		{name: "stop price", amount: "1", price: "1", stopPrice: "0.0001", reason: "stop price has more than 3 decimals"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := bid(0, tt.price, tt.amount)
+			o.StopPrice = tt.stopPrice
+			if got := checkPrecision(o, d); got != tt.reason {
+				t.Errorf("got %q, want %q", got, tt.reason)
+			}
+		})
+	}
+}
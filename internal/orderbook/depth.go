@@ -0,0 +1,151 @@
+package orderbook
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+)
+
+const (
+	// DefaultDepthLevels is the number of price levels per side returned if
+	// the caller does not ask for a specific depth.
+	DefaultDepthLevels = 10
+	// MaxDepthLevels bounds the number of price levels per side.
+	MaxDepthLevels = 500
+)
+
+// depthLevels clamps the requested number of levels to the supported range.
+func depthLevels(n int) int {
+	switch {
+	case n <= 0:
+		return DefaultDepthLevels
+	case n > MaxDepthLevels:
+		return MaxDepthLevels
+	}
+	return n
+}
+
+// Depth returns the top levels price levels per side of every market, or of
+// the given market only if it is not empty. Amounts include parts of orders
+// that are reserved for a pending fill.
+func (b *Book) Depth(levels int, market string) message.OrderBookDepth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	levels = depthLevels(levels)
+	keys := make([]string, 0, len(b.markets))
+	for k := range b.markets {
+		if market == "" || k == market {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	depth := message.OrderBookDepth{
+		ChannelID: b.chID,
+		Sequence:  b.sequence,
+		Levels:    levels,
+		Markets:   make([]message.MarketDepth, 0, len(keys)),
+	}
+	for _, k := range keys {
+		m := b.markets[k]
+		// Markets stay in the index once created, so leave out empty ones.
+		if len(m.bids.levels) == 0 && len(m.asks.levels) == 0 {
+			continue
+		}
+		depth.Markets = append(depth.Markets, message.MarketDepth{
+			Market: k,
+			Bids:   m.bids.depth(levels),
+			Asks:   m.asks.depth(levels),
+		})
+	}
+	return depth
+}
+
+// depth aggregates the best n levels of the side.
+func (s *bookSide) depth(n int) []message.PriceLevel {
+	if n > len(s.levels) {
+		n = len(s.levels)
+	}
+	out := make([]message.PriceLevel, n)
+	for i, lvl := range s.levels[:n] {
+		sum := new(big.Rat)
+		for _, o := range lvl.orders {
+			sum.Add(sum, o.remaining)
+		}
+		out[i] = message.PriceLevel{
+			Price:  formatRat(lvl.price),
+			Amount: formatRat(sum),
+			Orders: len(lvl.orders),
+		}
+	}
+	return out
+}
+
+// DiffDepth returns the price levels that differ between prev and next. Levels
+// that are no longer part of next are reported with zero orders. It returns
+// false if nothing changed.
+func DiffDepth(prev, next message.OrderBookDepth) (message.OrderBookDepthDelta, bool) {
+	prevMarkets := make(map[string]message.MarketDepth, len(prev.Markets))
+	for _, m := range prev.Markets {
+		prevMarkets[m.Market] = m
+	}
+	nextMarkets := make(map[string]message.MarketDepth, len(next.Markets))
+	for _, m := range next.Markets {
+		nextMarkets[m.Market] = m
+	}
+
+	keys := make([]string, 0, len(prevMarkets)+len(nextMarkets))
+	for k := range nextMarkets {
+		keys = append(keys, k)
+	}
+	for k := range prevMarkets {
+		if _, ok := nextMarkets[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	delta := message.OrderBookDepthDelta{
+		ChannelID: next.ChannelID,
+		Sequence:  next.Sequence,
+	}
+	for _, k := range keys {
+		p, n := prevMarkets[k], nextMarkets[k]
+		bids := diffLevels(p.Bids, n.Bids)
+		asks := diffLevels(p.Asks, n.Asks)
+		if len(bids) == 0 && len(asks) == 0 {
+			continue
+		}
+		delta.Markets = append(delta.Markets, message.MarketDepth{
+			Market: k,
+			Bids:   bids,
+			Asks:   asks,
+		})
+	}
+	return delta, len(delta.Markets) > 0
+}
+
+// diffLevels returns the levels of next that are new or changed, followed by
+// the levels of prev that are gone.
+func diffLevels(prev, next []message.PriceLevel) []message.PriceLevel {
+	old := make(map[string]message.PriceLevel, len(prev))
+	for _, l := range prev {
+		old[l.Price] = l
+	}
+
+	out := []message.PriceLevel{}
+	for _, l := range next {
+		if o, ok := old[l.Price]; !ok || o != l {
+			out = append(out, l)
+		}
+		delete(old, l.Price)
+	}
+	for _, l := range prev {
+		if _, ok := old[l.Price]; ok {
+			out = append(out, message.PriceLevel{Price: l.Price, Amount: "0"})
+		}
+	}
+	return out
+}
@@ -1,116 +1,230 @@
 package orderbook
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/perun-network/perun-dex-websocket/internal/message"
 	"perun.network/go-perun/channel"
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/wallet"
 )
 
 // Engine manages all per-channel order books.
 type Engine struct {
 	mu    sync.RWMutex
 	books map[channel.ID]*Book
+	// dir is the directory books are persisted in, empty if the engine only
+	// keeps them in memory.
+	dir string
+	// hubs are the consolidated books by their hub's L2 address and routes
+	// the channels whose orders go to a consolidated book.
+	hubs   map[string]*Book
+	routes map[channel.ID]*Book
+	// archived are the closed channels. Their books are evicted from memory
+	// and kept as nil once they are in the archive directory, from which
+	// they are read on demand.
+	archived map[channel.ID]*Book
+	// archive caches the archived books read from disk.
+	archive *archiveCache
+
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
-// NewEngine creates a new order book engine.
+// NewEngine creates a new order book engine that keeps all books in memory.
+// Use OpenEngine for an engine that persists them.
 func NewEngine() *Engine {
 	return &Engine{
-		books: make(map[channel.ID]*Book),
+		books:    make(map[channel.ID]*Book),
+		hubs:     make(map[string]*Book),
+		routes:   make(map[channel.ID]*Book),
+		archived: make(map[channel.ID]*Book),
+		archive:  newArchiveCache(ArchiveCacheSize),
+		closed:   make(chan struct{}),
 	}
 }
 
-// GetOrCreateBook returns or creates a book for a channel.
+// GetOrCreateBook returns or creates a book for a channel. Channels of a hub
+// in consolidated mode share the hub's book.
 func (e *Engine) GetOrCreateBook(chID channel.ID) *Book {
 	e.mu.Lock()
-	defer e.mu.Unlock()
+	if _, ok := e.archived[chID]; !ok {
+		defer e.mu.Unlock()
+		return e.getOrCreateBook(chID)
+	}
+	e.mu.Unlock()
+	// Archived books are read without blocking the engine. A channel is
+	// never unarchived.
+	b, _ := e.archivedBook(chID)
+	return b
+}
 
+// getOrCreateBook is GetOrCreateBook for a channel that is not archived with
+// e.mu held.
+func (e *Engine) getOrCreateBook(chID channel.ID) *Book {
+	if b, ok := e.routes[chID]; ok {
+		return b
+	}
 	b, ok := e.books[chID]
-	if !ok {
-		b = newBook(chID)
-		e.books[chID] = b
+	if ok {
+		return b
 	}
+	b = newBook(chID)
+	if e.dir != "" {
+		pb, err := e.openBook(chID)
+		if err != nil {
+			log.Errorf("order book %x: opening store, keeping book in memory only: %v", chID, err)
+		} else {
+			b = pb
+		}
+	}
+	e.books[chID] = b
 	return b
 }
 
-// GetBook returns an existing book if it exists.
-func (e *Engine) GetBook(chID channel.ID) (*Book, bool) {
+// allBooks returns all books of the engine.
+func (e *Engine) allBooks() []*Book {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
-	b, ok := e.books[chID]
+
+	books := make([]*Book, 0, len(e.books))
+	for _, b := range e.books {
+		books = append(books, b)
+	}
+	return books
+}
+
+// GetBook returns an existing book if it exists. Channels of a hub in
+// consolidated mode share the hub's book.
+func (e *Engine) GetBook(chID channel.ID) (*Book, bool) {
+	e.mu.RLock()
+	b, ok := e.routes[chID]
+	if !ok {
+		b, ok = e.books[chID]
+	}
+	_, archived := e.archived[chID]
+	e.mu.RUnlock()
+	if archived {
+		return e.archivedBook(chID)
+	}
 	return b, ok
 }
 
-// Book represents a per-channel order book.
+// Book represents a per-channel order book. Orders are grouped into markets
+// per base/quote pair and matched with price-time priority.
 type Book struct {
 	chID      channel.ID
 	mu        sync.Mutex
 	sequence  uint64
 	totalOpen uint64
-	bids      map[message.OrderID]message.Order
-	asks      map[message.OrderID]message.Order
-
-	// Subscribers for broadcasting
-	subscribers map[chan []byte]bool
-	subMu       sync.RWMutex
+	markets   map[string]*market
+	orders    map[message.OrderID]*bookOrder
+	journal   *journal
+	// funds is the balance committed to open orders per maker and asset.
+	funds map[fundKey]*big.Rat
+	// stops are the hidden stop orders in the order they were created and
+	// lastPrice the last trade price per market that triggers them.
+	stops     []*stopOrder
+	lastPrice map[string]*big.Rat
+	// trades are the last trades settled in the book, oldest first, at most
+	// twice TradeWindow. tradeLog is the path of the log of all trades,
+	// empty if the book is not persisted.
+	trades   []message.Trade
+	tradeLog string
+	// store persists the book, nil for in-memory books.
+	store *bookStore
+	// hub is the L2 address of the hub whose channels share this book, nil
+	// for the book of a single channel.
+	hub wallet.Address
+	// settings are the options set by the book's participants.
+	settings settings
+	// final are the channels whose state is final. Their orders are
+	// canceled and new ones rejected. closed is set once the book is
+	// archived, which makes it read-only.
+	final  map[channel.ID]struct{}
+	closed bool
+	// nextAuction is the unix time of the next batch auction and batch the
+	// auction being settled, if any.
+	nextAuction int64
+	batch       *auctionBatch
+
+	// subscribers receive the published deltas.
+	subscribers map[*Subscription]struct{}
 }
 
 func newBook(chID channel.ID) *Book {
 	return &Book{
 		chID:        chID,
-		bids:        make(map[message.OrderID]message.Order),
-		asks:        make(map[message.OrderID]message.Order),
-		subscribers: make(map[chan []byte]bool),
+		markets:     make(map[string]*market),
+		orders:      make(map[message.OrderID]*bookOrder),
+		journal:     newJournal(JournalSize),
+		funds:       make(map[fundKey]*big.Rat),
+		lastPrice:   make(map[string]*big.Rat),
+		final:       make(map[channel.ID]struct{}),
+		subscribers: make(map[*Subscription]struct{}),
 	}
 }
 
-// Subscribe adds a channel to receive delta broadcasts.
-func (b *Book) Subscribe(ch chan []byte) {
-	b.subMu.Lock()
-	defer b.subMu.Unlock()
-	b.subscribers[ch] = true
+// publish assigns the next sequence number to the delta, records it in the
+// journal and write-ahead log and queues it for the subscribers. Must be
+// called with b.mu held.
+func (b *Book) publish(delta message.OrderBookDelta) {
+	b.sequence++
+	delta.ChannelID = b.chID
+	delta.Sequence = b.sequence
+	delta.TotalOpen = b.totalOpen
+	b.journal.append(delta)
+	b.persist(delta)
+	b.broadcast(delta)
 }
 
-// Unsubscribe removes a subscriber channel.
-func (b *Book) Unsubscribe(ch chan []byte) {
-	b.subMu.Lock()
-	defer b.subMu.Unlock()
-	delete(b.subscribers, ch)
-	close(ch)
+// marketFor returns the market of the order's pair, creating it if needed.
+func (b *Book) marketFor(o message.Order) *market {
+	key := marketKey(o)
+	m, ok := b.markets[key]
+	if !ok {
+		m = newMarket()
+		b.markets[key] = m
+	}
+	return m
 }
 
-// broadcast sends a delta to all subscribers.
-func (b *Book) broadcast(delta message.OrderBookDelta) {
-	frame := message.JSONObject{Message: &delta}
-	data, _ := json.Marshal(frame)
-
-	b.subMu.RLock()
-	defer b.subMu.RUnlock()
+// sortedMarkets returns the markets ordered by their pair key so that
+// snapshots are stable.
+func (b *Book) sortedMarkets() []*market {
+	keys := make([]string, 0, len(b.markets))
+	for k := range b.markets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-	for ch := range b.subscribers {
-		select {
-		case ch <- data:
-		default:
-			// Non-blocking send; drop slow consumers
-		}
+	ms := make([]*market, len(keys))
+	for i, k := range keys {
+		ms[i] = b.markets[k]
 	}
+	return ms
 }
 
-// Snapshot returns current state.
+// Snapshot returns current state. Orders are listed per market in priority
+// order.
 func (b *Book) Snapshot() message.OrderBookSnapshot {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	return b.snapshot()
+}
 
-	bids := make([]message.Order, 0, len(b.bids))
-	for _, o := range b.bids {
-		bids = append(bids, o)
-	}
-
-	asks := make([]message.Order, 0, len(b.asks))
-	for _, o := range b.asks {
-		asks = append(asks, o)
+// snapshot is Snapshot with b.mu held.
+func (b *Book) snapshot() message.OrderBookSnapshot {
+	bids := make([]message.Order, 0, len(b.orders))
+	asks := make([]message.Order, 0, len(b.orders))
+	for _, m := range b.sortedMarkets() {
+		bids = append(bids, m.bids.rows()...)
+		asks = append(asks, m.asks.rows()...)
 	}
 
 	return message.OrderBookSnapshot{
@@ -122,83 +236,392 @@ func (b *Book) Snapshot() message.OrderBookSnapshot {
 	}
 }
 
-// CreateOrder adds an order and broadcasts delta.
-func (b *Book) CreateOrder(o message.Order) message.CreateOrderAck {
+// Admission holds what the book checks an incoming order against.
+type Admission struct {
+	// Balance is the maker's channel balance of the order's CommittedAsset
+	// in whole units. The order is rejected if it commits more than what is
+	// left of it after the maker's other open orders. Nil skips the check.
+	Balance *big.Rat
+	// Signer is the maker's L2 address the order's signature must verify
+	// against. Nil skips the check.
+	Signer wallet.Address
+	// Trader is the maker's L2 address, which identifies its orders across
+	// channels for self-trade prevention. Nil identifies the maker by its
+	// channel and index.
+	Trader wallet.Address
+	// Decimals are the decimals of the order's assets. The amount must be a
+	// whole number of base units and the prices must not have more decimals
+	// than the quote asset. Nil skips the check.
+	Decimals *Decimals
+}
+
+// CreateOrder matches the order against the opposite side of its market and
+// rests any remainder in the book. Crossing amounts are reserved as fills that
+// the caller settles in the channel; the maker orders are broadcast as Updated
+// or Removed once their fill is committed.
+func (b *Book) CreateOrder(o message.Order, adm Admission) (message.CreateOrderAck, []*Fill) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	o.Status = message.OrderOpen
-	if o.CreatedAt == 0 {
-		o.CreatedAt = time.Now().Unix()
+	// The book assigns the ID; clients refer to their orders by ClientTag
+	// until they learn it from the ack.
+	o.ID = newOrderID()
+	if b.hub == nil {
+		o.ChannelID = b.chID
+	}
+	o.Trader = ""
+	if adm.Trader != nil {
+		o.Trader = adm.Trader.String()
 	}
 
-	switch o.Side {
-	case message.SideBid:
-		b.bids[o.ID] = o
-	case message.SideAsk:
-		b.asks[o.ID] = o
-	default:
+	reject := func(reason string) (message.CreateOrderAck, []*Fill) {
 		return message.CreateOrderAck{
-			ID:       o.ID,
-			Accepted: false,
-			Reason:   "invalid side",
+			ID:        o.ID,
+			ClientTag: o.ClientTag,
+			Accepted:  false,
+			Reason:    reason,
+			TotalOpen: b.totalOpen,
+		}, nil
+	}
+
+	if reason := b.checkOpen(o.ChannelID); reason != "" {
+		return reject(reason)
+	}
+	if o.Side != message.SideBid && o.Side != message.SideAsk {
+		return reject("invalid side")
+	}
+	if o.Base == nil || o.Quote == nil {
+		return reject("missing base or quote asset")
+	}
+	if isExpired(o, time.Now().Unix()) {
+		return reject("order already expired")
+	}
+	amount, ok := parsePositive(o.Amount)
+	if !ok {
+		return reject("invalid amount")
+	}
+	if reason := checkExecution(o); reason != "" {
+		return reject(reason)
+	}
+	if b.auctionMode() && (isMarket(o) || isStop(o) || !rests(o)) {
+		return reject("auction book only accepts resting limit orders")
+	}
+	// The fills of a consolidated book are settled one by one in different
+	// channels, so they cannot be executed all or none.
+	if b.hub != nil && o.TimeInForce == message.TimeFOK {
+		return reject("consolidated book does not accept fill-or-kill orders")
+	}
+	if adm.Decimals != nil {
+		if reason := checkPrecision(o, *adm.Decimals); reason != "" {
+			return reject(reason)
 		}
 	}
+	// Market orders have no price and cross any price.
+	var price *big.Rat
+	if !isMarket(o) {
+		if price, ok = parsePositive(o.Price); !ok {
+			return reject("invalid price")
+		}
+	}
+	if adm.Signer != nil {
+		if err := VerifyOrder(o, adm.Signer); err != nil {
+			return reject(err.Error())
+		}
+	}
+	if o.CreatedAt == 0 {
+		o.CreatedAt = time.Now().Unix()
+	}
 
-	b.totalOpen++
-	b.sequence++
+	m := b.marketFor(o)
+	if isStop(o) {
+		if reason := b.addStop(o, price, amount, adm.Balance); reason != "" {
+			return reject(reason)
+		}
+		return message.CreateOrderAck{
+			ID:        o.ID,
+			ClientTag: o.ClientTag,
+			Accepted:  true,
+			TotalOpen: b.totalOpen,
+		}, nil
+	}
 
-	delta := message.OrderBookDelta{
-		ChannelID: b.chID,
-		Sequence:  b.sequence,
-		Added:     []message.Order{o},
-		TotalOpen: b.totalOpen,
+	if o.PostOnly && !b.auctionMode() {
+		if best := b.bestMatchable(m.opposite(o.Side)); best != nil && crosses(o.Side, price, best) {
+			return reject("post-only order would cross the book")
+		}
+	}
+	if adm.Balance != nil {
+		var key fundKey
+		var need *big.Rat
+		if price == nil && o.Side == message.SideBid {
+			// A market bid commits what the book currently asks for.
+			_, cost := b.preview(m, o, price, amount)
+			key, need = committedKey(o), cost
+		} else {
+			key, need = commitment(o, price, amount)
+		}
+		if reason := b.checkFunds(key, need, adm.Balance); reason != "" {
+			return reject(reason)
+		}
 	}
 
-	go b.broadcast(delta)
+	o.Status = message.OrderOpen
+	fills, canceled, selfTrade, reason := b.place(m, o, price, amount)
+	if reason != "" {
+		return reject(reason)
+	}
 
-	return message.CreateOrderAck{
+	ack := message.CreateOrderAck{
 		ID:        o.ID,
+		ClientTag: o.ClientTag,
 		Accepted:  true,
 		TotalOpen: b.totalOpen,
+		SelfTrade: selfTrade,
+	}
+	if canceled != nil {
+		ack.Canceled = formatRat(canceled)
 	}
+	return ack, fills
 }
 
-// CancelOrder removes an order and broadcasts delta.
-func (b *Book) CancelOrder(id message.OrderID) message.CancelOrderAck {
+// place matches the order and rests any remainder if its time in force
+// allows it, otherwise the remainder is returned as canceled. Resting orders
+// of the same maker are skipped or canceled according to the order's
+// self-trade prevention; selfTrade reports whether it canceled the remainder.
+// Orders that cannot be executed as requested are not placed; the reason is
+// returned instead. Must be called with b.mu held.
+func (b *Book) place(m *market, o message.Order, price, amount *big.Rat) (fills []*Fill, canceled *big.Rat, selfTrade bool, reason string) {
+	fillable, _ := b.preview(m, o, price, amount)
+	if o.TimeInForce == message.TimeFOK && fillable.Cmp(amount) < 0 {
+		return nil, nil, false, "fill-or-kill order cannot be filled completely"
+	}
+	if isMarket(o) && fillable.Sign() == 0 {
+		return nil, nil, false, "no liquidity for market order"
+	}
+
+	// In auction mode orders are only matched when the auction clears.
+	taker := newBookOrder(o, price, amount)
+	var own []*bookOrder
+	if b.auctionMode() {
+		own, selfTrade = b.selfCrossing(m, taker)
+	} else {
+		fills, own, selfTrade = b.match(m, taker)
+	}
+	var delta message.OrderBookDelta
+	for _, mo := range own {
+		b.cancelResting(mo, message.RemoveSelfTrade, &delta)
+	}
+
+	switch {
+	case taker.remaining.Sign() == 0:
+	case selfTrade || !rests(o):
+		canceled = new(big.Rat).Set(taker.remaining)
+		taker.left = true
+	default:
+		m.own(o.Side).insert(taker)
+		b.orders[o.ID] = taker
+		b.lockFunds(taker)
+		b.totalOpen++
+		delta.Added = append(delta.Added, taker.row())
+	}
+	if len(delta.Added) > 0 || len(delta.Removed) > 0 {
+		b.publish(delta)
+	}
+	return fills, canceled, selfTrade, ""
+}
+
+// checkExecution validates the combination of order type, time in force and
+// post-only flag as well as the self-trade prevention mode. It returns the
+// reason for rejecting the order or "".
+func checkExecution(o message.Order) string {
+	switch o.Type {
+	case "", message.OrderLimit, message.OrderMarket, message.OrderStop, message.OrderStopLimit:
+	default:
+		return "invalid order type"
+	}
+	switch o.TimeInForce {
+	case "", message.TimeGTC, message.TimeGTT, message.TimeIOC, message.TimeFOK:
+	default:
+		return "invalid time in force"
+	}
+	switch o.SelfTradePrevention {
+	case "", message.SelfTradeCancelNewest, message.SelfTradeCancelOldest, message.SelfTradeCancelBoth:
+	default:
+		return "invalid self-trade prevention mode"
+	}
+
+	immediate := o.TimeInForce == message.TimeIOC || o.TimeInForce == message.TimeFOK
+	switch {
+	case o.TimeInForce == message.TimeGTT && o.ExpiresAt == nil:
+		return "good-till-time order needs expiresAt"
+	case isMarket(o) && o.Price != "":
+		return "market order must not have a price"
+	case isMarket(o) && o.TimeInForce != "" && !immediate:
+		return "market order must be IOC or FOK"
+	case o.PostOnly && (immediate || isMarket(o) || isStop(o)):
+		return "post-only order must be a resting limit order"
+	case !isStop(o) && o.StopPrice != "":
+		return "stop price is only allowed for stop orders"
+	}
+	return ""
+}
+
+// isMarket reports whether the order trades at any price once it is live.
+func isMarket(o message.Order) bool {
+	return o.Type == message.OrderMarket || o.Type == message.OrderStop
+}
+
+// rests reports whether the unmatched remainder of the order is added to the
+// book.
+func rests(o message.Order) bool {
+	if isMarket(o) {
+		return false
+	}
+	return o.TimeInForce != message.TimeIOC && o.TimeInForce != message.TimeFOK
+}
+
+// newOrderID returns a random order ID.
+func newOrderID() message.OrderID {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err)
+	}
+	return message.OrderID(hex.EncodeToString(id[:]))
+}
+
+// match reserves the available amounts of the best resting orders of the
+// opposite side for the taker as long as the prices cross. It returns the
+// resting orders of the taker's maker that its self-trade prevention cancels
+// and whether it ended the matching. Must be called with b.mu held.
+func (b *Book) match(m *market, taker *bookOrder) (fills []*Fill, own []*bookOrder, stopped bool) {
+	stopped = b.walk(m, taker.order, taker.price, taker.remaining, func(maker *bookOrder, qty *big.Rat) {
+		taker.remaining.Sub(taker.remaining, qty)
+		f := b.reserve(maker, qty, taker.order.ID, taker.order.ChannelID, taker.order.MakerIdx)
+		f.incoming = taker
+		fills = append(fills, f)
+	}, func(maker *bookOrder) {
+		own = append(own, maker)
+	})
+	return fills, own, stopped
+}
+
+// preview returns how much of amount would be matched for the taker o at
+// price and what the matched amount costs in the quote asset, without
+// reserving anything. Must be called with b.mu held.
+func (b *Book) preview(m *market, o message.Order, price, amount *big.Rat) (qty, cost *big.Rat) {
+	qty, cost = new(big.Rat), new(big.Rat)
+	b.walk(m, o, price, amount, func(maker *bookOrder, q *big.Rat) {
+		qty.Add(qty, q)
+		cost.Add(cost, new(big.Rat).Mul(q, maker.price))
+	}, nil)
+	return qty, cost
+}
+
+// walk calls fn in priority order with each resting order of the opposite
+// side that the taker o at price would match and the amount it would take
+// from it, until amount is used up. A nil price crosses every price. Reserved
+// and expired amounts are skipped. Orders of the taker's maker are never
+// matched: they are passed to self if the taker's self-trade prevention
+// cancels them, and end the walk unless it cancels only them. walk reports
+// whether a self-trade ended it. Must be called with b.mu held.
+func (b *Book) walk(m *market, o message.Order, price, amount *big.Rat, fn func(maker *bookOrder, qty *big.Rat), self func(maker *bookOrder)) bool {
+	left := new(big.Rat).Set(amount)
+	now := time.Now().Unix()
+	mode := selfTradeMode(o)
+	for _, lvl := range m.opposite(o.Side).levels {
+		if left.Sign() == 0 || !crosses(o.Side, price, lvl.price) {
+			return false
+		}
+		for _, maker := range lvl.orders {
+			if left.Sign() == 0 {
+				return false
+			}
+			avail := maker.available()
+			if avail.Sign() == 0 || isExpired(maker.order, now) || b.withdrawn(maker) {
+				continue
+			}
+			if isSelfTrade(o, maker.order) {
+				if mode != message.SelfTradeCancelNewest && self != nil {
+					self(maker)
+				}
+				if mode != message.SelfTradeCancelOldest {
+					return true
+				}
+				continue
+			}
+			qty := new(big.Rat).Set(minRat(left, avail))
+			left.Sub(left, qty)
+			fn(maker, qty)
+		}
+	}
+	return false
+}
+
+// bestMatchable returns the price of the best level of the side that has an
+// amount the book would match now, or nil. Like in walk, reserved and expired
+// amounts are skipped. Must be called with b.mu held.
+func (b *Book) bestMatchable(s *bookSide) *big.Rat {
+	now := time.Now().Unix()
+	for _, lvl := range s.levels {
+		for _, o := range lvl.orders {
+			if b.matchable(o, now) {
+				return lvl.price
+			}
+		}
+	}
+	return nil
+}
+
+// CancelOrder removes an order of the maker at index maker in channel chID
+// and broadcasts delta.
+func (b *Book) CancelOrder(id message.OrderID, chID channel.ID, maker channel.Index) message.CancelOrderAck {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	var found bool
-	if _, ok := b.bids[id]; ok {
-		delete(b.bids, id)
-		found = true
-	} else if _, ok := b.asks[id]; ok {
-		delete(b.asks, id)
-		found = true
+	o, ok := b.orders[id]
+	if !ok {
+		if s, ok := b.findStop(id); ok {
+			o = s.bookOrder
+		} else {
+			return message.CancelOrderAck{
+				ID:      id,
+				Success: false,
+				Reason:  "order not found",
+			}
+		}
 	}
-
-	if !found {
+	if o.order.ChannelID != chID || o.order.MakerIdx != maker {
 		return message.CancelOrderAck{
-			ID:      id,
-			Success: false,
-			Reason:  "order not found",
+			ID:        id,
+			Success:   false,
+			Reason:    "only the maker can cancel the order",
+			TotalOpen: b.totalOpen,
 		}
 	}
-
-	if b.totalOpen > 0 {
-		b.totalOpen--
+	if o.reserved.Sign() > 0 {
+		return message.CancelOrderAck{
+			ID:        id,
+			Success:   false,
+			Reason:    "order has a pending fill",
+			TotalOpen: b.totalOpen,
+		}
 	}
-	b.sequence++
 
-	delta := message.OrderBookDelta{
-		ChannelID: b.chID,
-		Sequence:  b.sequence,
-		Removed:   []message.OrderID{id},
-		TotalOpen: b.totalOpen,
+	// Waiting stop orders are not visible, so their cancellation is not
+	// published.
+	if o.order.Status == message.OrderPending {
+		b.removeStop(id)
+		return message.CancelOrderAck{
+			ID:        id,
+			Success:   true,
+			TotalOpen: b.totalOpen,
+		}
 	}
 
-	go b.broadcast(delta)
+	o.order.Status = message.OrderCanceled
+	var delta message.OrderBookDelta
+	b.removeOrder(o, message.RemoveCanceled, &delta)
+	b.publish(delta)
 
 	return message.CancelOrderAck{
 		ID:        id,
@@ -207,24 +630,92 @@ func (b *Book) CancelOrder(id message.OrderID) message.CancelOrderAck {
 	}
 }
 
-// AcceptOrder validates order exists for trading.
-func (b *Book) AcceptOrder(id message.OrderID) message.AcceptOrderAck {
+// AcceptOrder reserves amount of a resting order, or all that is available if
+// amount is empty, as a fill for the caller to settle with the participant at
+// taker as counterparty. trader is the taker's L2 address as in Admission, or
+// nil. The returned ack reports the amount that will remain once the fill is
+// committed.
+func (b *Book) AcceptOrder(id message.OrderID, amount string, takerCh channel.ID, taker channel.Index, trader wallet.Address) (message.AcceptOrderAck, *Fill) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	_, inBids := b.bids[id]
-	_, inAsks := b.asks[id]
-
-	if !inBids && !inAsks {
+	reject := func(reason string) (message.AcceptOrderAck, *Fill) {
 		return message.AcceptOrderAck{
 			ID:       id,
 			Accepted: false,
-			Reason:   "order not found",
+			Reason:   reason,
+		}, nil
+	}
+
+	if reason := b.checkOpen(takerCh); reason != "" {
+		return reject(reason)
+	}
+	if b.auctionMode() {
+		return reject("orders of an auction book are only filled in auctions")
+	}
+	o, ok := b.orders[id]
+	if !ok {
+		return reject("order not found")
+	}
+	// Accepting an order has no self-trade prevention mode to apply, so an
+	// order of the caller is never filled against the caller.
+	caller := message.Order{ChannelID: takerCh, MakerIdx: taker}
+	if trader != nil {
+		caller.Trader = trader.String()
+	}
+	if isSelfTrade(caller, o.order) {
+		return reject("cannot accept own order")
+	}
+	if reason := b.checkOpen(o.order.ChannelID); reason != "" {
+		return reject(reason)
+	}
+	if o.canceling != "" {
+		return reject("order is being canceled")
+	}
+	// The reaper may not have run yet.
+	if isExpired(o.order, time.Now().Unix()) {
+		return reject("order expired")
+	}
+
+	avail := o.available()
+	if avail.Sign() == 0 {
+		return reject("order has a pending fill")
+	}
+	qty := avail
+	if amount != "" {
+		var ok bool
+		qty, ok = parsePositive(amount)
+		if !ok {
+			return reject("invalid amount")
+		}
+		if qty.Cmp(avail) > 0 {
+			return reject("amount exceeds remaining " + formatRat(avail))
 		}
 	}
 
+	fill := b.reserve(o, qty, "", takerCh, taker)
 	return message.AcceptOrderAck{
-		ID:       id,
-		Accepted: true,
+		ID:        id,
+		Accepted:  true,
+		Amount:    formatRat(qty),
+		Remaining: formatRat(new(big.Rat).Sub(o.remaining, qty)),
+	}, fill
+}
+
+// removeOrder takes the order out of its price level and the index and
+// records the removal with its reason in delta. Must be called with b.mu held.
+func (b *Book) removeOrder(o *bookOrder, reason message.RemoveReason, delta *message.OrderBookDelta) {
+	b.marketFor(o.order).own(o.order.Side).remove(o)
+	delete(b.orders, o.order.ID)
+	o.left = true
+	b.releaseFunds(o, o.remaining)
+	if b.totalOpen > 0 {
+		b.totalOpen--
+	}
+
+	delta.Removed = append(delta.Removed, o.order.ID)
+	if delta.Reasons == nil {
+		delta.Reasons = make(map[message.OrderID]message.RemoveReason)
 	}
+	delta.Reasons[o.order.ID] = reason
 }
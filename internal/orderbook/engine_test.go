@@ -0,0 +1,127 @@
+package orderbook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	ethwallet "github.com/perun-network/perun-eth-backend/wallet"
+	"perun.network/go-perun/channel"
+)
+
+func TestTimeInForce(t *testing.T) {
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Hour).Unix()
+	market := func(o message.Order, tif message.TimeInForce) message.Order {
+		o.Type, o.Price = message.OrderMarket, ""
+		return withTIF(o, tif)
+	}
+	expiring := func(o message.Order, at int64) message.Order {
+		o.ExpiresAt = &at
+		return withTIF(o, message.TimeGTT)
+	}
+	priced := func(o message.Order, price string) message.Order {
+		o.Price = price
+		return o
+	}
+	postOnly := func(o message.Order) message.Order {
+		o.PostOnly = true
+		return o
+	}
+
+	tests := []struct {
+		name     string
+		order    message.Order
+		reason   string // rejection reason, "" if accepted
+		fills    int
+		canceled string
+		rests    string
+	}{
+		{name: "GTC rests the remainder", order: bid(0, "10", "3"), fills: 1, rests: "2"},
+		{name: "IOC cancels the remainder", order: withTIF(bid(0, "10", "3"), message.TimeIOC), fills: 1, canceled: "2"},
+		{name: "IOC without match", order: withTIF(bid(0, "9", "1"), message.TimeIOC), canceled: "1"},
+		{name: "FOK filled completely", order: withTIF(bid(0, "10", "1"), message.TimeFOK), fills: 1},
+		{name: "FOK not fillable", order: withTIF(bid(0, "10", "3"), message.TimeFOK), reason: "fill-or-kill order cannot be filled completely"},
+		{name: "GTT rests until it expires", order: expiring(bid(0, "9", "1"), future), rests: "1"},
+		{name: "GTT without expiry", order: withTIF(bid(0, "9", "1"), message.TimeGTT), reason: "good-till-time order needs expiresAt"},
+		{name: "already expired", order: expiring(bid(0, "9", "1"), past), reason: "order already expired"},
+		{name: "market IOC", order: market(bid(0, "", "3"), message.TimeIOC), fills: 1, canceled: "2"},
+		{name: "market GTC", order: market(bid(0, "", "1"), message.TimeGTC), reason: "market order must be IOC or FOK"},
+		{name: "market with price", order: priced(market(bid(0, "", "1"), message.TimeIOC), "10"), reason: "market order must not have a price"},
+		{name: "market without liquidity", order: market(ask(0, "", "1"), message.TimeIOC), reason: "no liquidity for market order"},
+		{name: "post-only rests", order: postOnly(bid(0, "9", "1")), rests: "1"},
+		{name: "post-only crossing", order: postOnly(bid(0, "10", "1")), reason: "post-only order would cross the book"},
+		{name: "post-only IOC", order: postOnly(withTIF(bid(0, "9", "1"), message.TimeIOC)), reason: "post-only order must be a resting limit order"},
+		{name: "invalid time in force", order: withTIF(bid(0, "9", "1"), "DAY"), reason: "invalid time in force"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			createOrders(t, b, ask(1, "10", "1"))
+
+			ack, fills := submit(t, b, tt.order)
+			if ack.Reason != tt.reason || ack.Accepted != (tt.reason == "") {
+				t.Fatalf("accepted %t with reason %q, want %q", ack.Accepted, ack.Reason, tt.reason)
+			}
+			if len(fills) != tt.fills {
+				t.Errorf("got %d fills, want %d", len(fills), tt.fills)
+			}
+			if ack.Canceled != tt.canceled {
+				t.Errorf("canceled %q, want %q", ack.Canceled, tt.canceled)
+			}
+			if got := remaining(b, ack.ID); got != tt.rests {
+				t.Errorf("remaining %q, want %q", got, tt.rests)
+			}
+		})
+	}
+}
+
+func TestPostOnlyIgnoresReservedLevels(t *testing.T) {
+	b := NewEngine().GetOrCreateBook(channel.ID{1})
+	createOrders(t, b, ask(1, "10", "1"), ask(1, "11", "1"))
+
+	// The best ask is completely reserved by a pending fill.
+	_, fills := b.CreateOrder(bid(0, "10", "1"), Admission{})
+	if len(fills) != 1 {
+		t.Fatalf("got %d fills, want 1", len(fills))
+	}
+
+	tests := []struct {
+		price  string
+		reason string
+	}{
+		{price: "10"},
+		{price: "11", reason: "post-only order would cross the book"},
+	}
+	for _, tt := range tests {
+		o := bid(0, tt.price, "1")
+		o.PostOnly = true
+		if ack, _ := b.CreateOrder(o, Admission{}); ack.Reason != tt.reason {
+			t.Errorf("post-only bid at %s: reason %q, want %q", tt.price, ack.Reason, tt.reason)
+		}
+	}
+}
+
+func TestHubBookRejectsFillOrKill(t *testing.T) {
+	e := NewEngine()
+	hub := ethwallet.AsWalletAddr(common.Address{1})
+	b := e.EnableHub(hub)
+	chID := channel.ID{2}
+	if !e.RouteChannel(chID, hub) {
+		t.Fatal("channel not routed")
+	}
+
+	o := withTIF(bid(0, "10", "1"), message.TimeFOK)
+	o.ChannelID = chID
+	ack, _ := b.CreateOrder(o, Admission{})
+	if want := "consolidated book does not accept fill-or-kill orders"; ack.Accepted || ack.Reason != want {
+		t.Errorf("accepted %t with reason %q, want %q", ack.Accepted, ack.Reason, want)
+	}
+}
+
+func withTIF(o message.Order, tif message.TimeInForce) message.Order {
+	o.TimeInForce = tif
+	return o
+}
@@ -0,0 +1,81 @@
+package orderbook
+
+import (
+	"sort"
+	"time"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+)
+
+// ExpiryInterval is the default interval in which the engine reaps expired
+// orders.
+const ExpiryInterval = time.Second
+
+// RunExpiry removes orders past their ExpiresAt from all books every interval
+// until the engine is closed.
+func (e *Engine) RunExpiry(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			e.reap(now.Unix())
+		case <-e.closed:
+			return
+		}
+	}
+}
+
+// Close stops the background tasks of the engine. Persisted books are
+// snapshotted and their stores closed.
+func (e *Engine) Close() {
+	e.closeOnce.Do(func() {
+		close(e.closed)
+		for _, b := range e.allBooks() {
+			b.closeStore()
+		}
+	})
+}
+
+// reap expires orders in all books.
+func (e *Engine) reap(now int64) {
+	for _, b := range e.allBooks() {
+		b.expire(now)
+	}
+}
+
+// expire removes all expired orders of the book and broadcasts them in a
+// single delta. Orders with a pending fill are kept until the fill is settled.
+func (b *Book) expire(now int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expireStops(now)
+
+	var expired []*bookOrder
+	for _, o := range b.orders {
+		if isExpired(o.order, now) && o.reserved.Sign() == 0 {
+			expired = append(expired, o)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].order.ID < expired[j].order.ID
+	})
+
+	var delta message.OrderBookDelta
+	for _, o := range expired {
+		o.order.Status = message.OrderExpired
+		b.removeOrder(o, message.RemoveExpired, &delta)
+	}
+	b.publish(delta)
+}
+
+// isExpired reports whether the order is past its expiry at the given unix
+// time.
+func isExpired(o message.Order, now int64) bool {
+	return o.ExpiresAt != nil && *o.ExpiresAt <= now
+}
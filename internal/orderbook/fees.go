@@ -0,0 +1,65 @@
+package orderbook
+
+import (
+	"math/big"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"github.com/pkg/errors"
+)
+
+// MaxFeeBps bounds fee rates, so that a fee never exceeds what a party
+// receives.
+const MaxFeeBps = 10000
+
+// FeeRates are the fees of the maker and the taker of a fill in basis points
+// of the amount each of them receives: the base asset for the buyer and the
+// quote asset for the seller.
+type FeeRates struct {
+	Maker uint32
+	Taker uint32
+}
+
+// FeeSchedule configures the fees charged on fills of consolidated books,
+// which are credited to the hub. The rates of a market take precedence over
+// those of the asset a party receives; fills without either are free.
+type FeeSchedule struct {
+	// Markets maps market keys "<assetType>:<code>/<assetType>:<code>" of
+	// base and quote to their rates.
+	Markets map[string]FeeRates
+	// Assets maps asset keys "<assetType>:<code>" to their rates.
+	Assets map[string]FeeRates
+}
+
+// Validate checks that all rates are at most MaxFeeBps.
+func (s FeeSchedule) Validate() error {
+	for key, r := range s.Markets {
+		if r.Maker > MaxFeeBps || r.Taker > MaxFeeBps {
+			return errors.Errorf("market %s: fee rate above %d bps", key, MaxFeeBps)
+		}
+	}
+	for key, r := range s.Assets {
+		if r.Maker > MaxFeeBps || r.Taker > MaxFeeBps {
+			return errors.Errorf("asset %s: fee rate above %d bps", key, MaxFeeBps)
+		}
+	}
+	return nil
+}
+
+// Rates returns the rates that apply to a party of a fill of the maker order
+// that receives the given asset.
+func (s FeeSchedule) Rates(maker message.Order, received message.Asset) FeeRates {
+	if r, ok := s.Markets[marketKey(maker)]; ok {
+		return r
+	}
+	if r, ok := s.Assets[assetKey(received)]; ok {
+		return r
+	}
+	return FeeRates{}
+}
+
+// FeeUnits returns the fee of bps basis points on amount smallest units,
+// rounded down in favor of the paying party.
+func FeeUnits(amount *big.Int, bps uint32) *big.Int {
+	fee := new(big.Int).Mul(amount, big.NewInt(int64(bps)))
+	return fee.Quo(fee, big.NewInt(10000))
+}
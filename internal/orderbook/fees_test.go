@@ -0,0 +1,68 @@
+package orderbook
+
+import (
+	"math/big"
+	"testing"
+
+	"perun.network/go-perun/channel"
+)
+
+func TestFeeUnits(t *testing.T) {
+	tests := []struct {
+		amount int64
+		bps    uint32
+		fee    int64
+	}{
+		{amount: 10000, bps: 30, fee: 30},
+		{amount: 12345, bps: 25, fee: 30}, // 30.8625 rounded down
+		{amount: 333, bps: 1, fee: 0},     // 0.0333 rounded down
+		{amount: 1000, bps: 0, fee: 0},
+		{amount: 1000, bps: MaxFeeBps, fee: 1000},
+	}
+
+	for _, tt := range tests {
+		if got := FeeUnits(big.NewInt(tt.amount), tt.bps); got.Int64() != tt.fee {
+			t.Errorf("%d bps of %d: got %v, want %d", tt.bps, tt.amount, got, tt.fee)
+		}
+	}
+}
+
+func TestFeeRates(t *testing.T) {
+	market := ask(0, "10", "1")
+	s := FeeSchedule{
+		Markets: map[string]FeeRates{marketKey(market): {Maker: 1, Taker: 2}},
+		Assets:  map[string]FeeRates{assetKey(testQuote): {Maker: 3, Taker: 4}},
+	}
+	other := market
+	other.Base = testQuote
+	other.Quote = testBase
+
+	if got := s.Rates(market, testQuote); got != (FeeRates{1, 2}) {
+		t.Errorf("market rates %v, want the market's over the asset's", got)
+	}
+	if got := s.Rates(other, testQuote); got != (FeeRates{3, 4}) {
+		t.Errorf("rates %v, want those of the received asset", got)
+	}
+	if got := s.Rates(other, testBase); got != (FeeRates{}) {
+		t.Errorf("rates %v without schedule entry, want none", got)
+	}
+
+	if err := s.Validate(); err != nil {
+		t.Errorf("valid schedule: %v", err)
+	}
+	s.Assets[assetKey(testBase)] = FeeRates{Taker: MaxFeeBps + 1}
+	if err := s.Validate(); err == nil {
+		t.Error("rate above the maximum accepted")
+	}
+}
+
+func TestCommitFillRecordsFees(t *testing.T) {
+	b := NewEngine().GetOrCreateBook(channel.ID{1})
+	createOrders(t, b, ask(1, "10", "2"))
+
+	_, fills := submit(t, b, bid(0, "10", "1"))
+	trade, _ := b.CommitFill(fills[0], Settlement{MakerFee: big.NewRat(3, 100), TakerFee: new(big.Rat)})
+	if trade.MakerFee != "0.03" || trade.TakerFee != "" {
+		t.Errorf("trade fees %q and %q, want 0.03 and none", trade.MakerFee, trade.TakerFee)
+	}
+}
@@ -0,0 +1,279 @@
+package orderbook
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+// Fill is an amount of a resting maker order that is reserved while the trade
+// is settled through a channel update. Every fill handed out by the book must
+// be passed to exactly one of CommitFill or AbortFill.
+type Fill struct {
+	// Maker is the maker order as it was when the fill was reserved.
+	Maker message.Order
+	// TakerOrderID is the incoming order that crossed the maker order. It is
+	// empty if the fill was created by AcceptOrder.
+	TakerOrderID message.OrderID
+	TakerSide    message.OrderSide
+	// TakerChannel and TakerIdx identify the participant on the taker side.
+	// TakerChannel differs from the maker's channel only in consolidated
+	// books.
+	TakerChannel channel.ID
+	TakerIdx     channel.Index
+	Amount       *big.Rat
+	// Price is the price the fill executes at. It is the maker's price,
+	// except for fills of a batch auction, which all execute at the auction's
+	// clearing price.
+	Price string
+	// Canceled is the amount of the incoming taker order that AbortFill
+	// canceled because it could not be given back to the order, nil if none.
+	Canceled *big.Rat
+
+	maker *bookOrder
+	price *big.Rat
+	// taker is the resting taker order of an auction fill, whose amount is
+	// reserved like the maker's. batch is the auction the fill belongs to.
+	taker *bookOrder
+	batch *auctionBatch
+	// incoming is the order that took the fill on arrival.
+	incoming *bookOrder
+}
+
+// AllOrNone reports whether the fill was taken by a fill-or-kill order, whose
+// fills must be settled in a single channel update.
+func (f *Fill) AllOrNone() bool {
+	return f.incoming != nil && f.incoming.order.TimeInForce == message.TimeFOK
+}
+
+// reserve books amount of the maker order for settlement. Must be called with
+// b.mu held.
+func (b *Book) reserve(maker *bookOrder, amount *big.Rat, takerID message.OrderID, takerCh channel.ID, takerIdx channel.Index) *Fill {
+	maker.reserved.Add(maker.reserved, amount)
+	return &Fill{
+		Maker:        maker.row(),
+		TakerOrderID: takerID,
+		TakerSide:    oppositeSide(maker.order.Side),
+		TakerChannel: takerCh,
+		TakerIdx:     takerIdx,
+		Amount:       new(big.Rat).Set(amount),
+		Price:        maker.order.Price,
+		maker:        maker,
+		price:        maker.price,
+	}
+}
+
+// Settlement describes the channel updates that executed a fill.
+type Settlement struct {
+	// Version is the state version of the maker's channel after the fill.
+	Version uint64
+	// TakerVersion is the state version of the taker's channel after the
+	// fill if the fill was settled in two channels through a hub.
+	TakerVersion uint64
+	// MakerFee and TakerFee are the fees the hub charged in the updates in
+	// whole units of the asset the respective party received, nil if none.
+	MakerFee, TakerFee *big.Rat
+}
+
+// CommitFill marks the fill as executed once the peers accepted the channel
+// updates. The maker order is broadcast as Updated, or Removed if it is now
+// fully filled, and the trade is added to the trade log. The trade's price may
+// trigger stop orders; the fills of the released orders are returned and
+// must be settled like any other fill. The changes of auction fills are
+// broadcast together once the whole auction is settled.
+func (b *Book) CommitFill(f *Fill, s Settlement) (message.Trade, []*Fill) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var delta message.OrderBookDelta
+	maker := f.maker
+	maker.reserved.Sub(maker.reserved, f.Amount)
+	maker.fill(f.Amount)
+	b.releaseFunds(maker, f.Amount)
+	b.settleResting(maker, &delta)
+
+	if f.taker != nil {
+		// The resting taker of an auction is filled like the maker.
+		taker := f.taker
+		taker.reserved.Sub(taker.reserved, f.Amount)
+		taker.fill(f.Amount)
+		b.releaseFunds(taker, f.Amount)
+		b.settleResting(taker, &delta)
+	} else if f.incoming != nil {
+		b.fillIncoming(f.incoming, f.Amount, &delta)
+	}
+
+	trade := b.newTrade(f, s)
+	if f.batch != nil {
+		b.persistPending(delta)
+		f.batch.commit(trade.Market, f.Amount, delta)
+		b.finishFill(f.batch)
+	} else {
+		b.publish(delta)
+	}
+	b.logTrade(&trade)
+	return trade, b.recordTrade(trade.Market, f.price)
+}
+
+// CommitTakerLeg records a fill of a consolidated book of which only the
+// taker's update was settled, as the maker's channel rejected its update and
+// the hub failed to undo the taker's. The taker order is filled, while the
+// maker's reservation is released like in AbortFill. The trade is logged as
+// unbalanced so that the hub's open position can be reconciled; it does not
+// count as the market's last price and triggers no stop orders.
+func (b *Book) CommitTakerLeg(f *Fill, s Settlement) message.Trade {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var delta message.OrderBookDelta
+	maker := f.maker
+	maker.reserved.Sub(maker.reserved, f.Amount)
+	if _, ok := b.orders[maker.order.ID]; ok {
+		if reason := b.closing(maker); reason != "" {
+			maker.order.Status = message.OrderCanceled
+			b.removeOrder(maker, reason, &delta)
+		}
+	}
+	if f.taker != nil {
+		taker := f.taker
+		taker.reserved.Sub(taker.reserved, f.Amount)
+		taker.fill(f.Amount)
+		b.releaseFunds(taker, f.Amount)
+		b.settleResting(taker, &delta)
+	} else if f.incoming != nil {
+		b.fillIncoming(f.incoming, f.Amount, &delta)
+	}
+
+	trade := b.newTrade(f, s)
+	trade.Unbalanced = true
+	if f.batch != nil {
+		b.persistPending(delta)
+		f.batch.abort(delta)
+		b.finishFill(f.batch)
+	} else if len(delta.Updated) > 0 || len(delta.Removed) > 0 {
+		b.publish(delta)
+	}
+	b.logTrade(&trade)
+	return trade
+}
+
+// fillIncoming records a settled fill of the incoming order that took it. Its
+// matched amount already left its open amount when the fill was reserved, so
+// only its filled amount changes, which is published if the order rests in
+// the book. Must be called with b.mu held.
+func (b *Book) fillIncoming(t *bookOrder, amount *big.Rat, delta *message.OrderBookDelta) {
+	t.filled.Add(t.filled, amount)
+	t.order.Status = message.OrderAccepted
+	if _, ok := b.orders[t.order.ID]; ok {
+		delta.Updated = append(delta.Updated, t.row())
+	}
+}
+
+// newTrade returns the trade executed by the fill. Must be called with b.mu
+// held.
+func (b *Book) newTrade(f *Fill, s Settlement) message.Trade {
+	trade := message.Trade{
+		ChannelID:    f.maker.order.ChannelID,
+		Market:       marketKey(f.maker.order),
+		MakerOrderID: f.maker.order.ID,
+		TakerOrderID: f.TakerOrderID,
+		TakerSide:    f.TakerSide,
+		Price:        f.Price,
+		Amount:       formatRat(f.Amount),
+		Version:      s.Version,
+		Timestamp:    time.Now().Unix(),
+	}
+	if b.hub != nil {
+		takerCh := f.TakerChannel
+		trade.TakerChannelID = &takerCh
+		trade.TakerVersion = s.TakerVersion
+	}
+	if s.MakerFee != nil && s.MakerFee.Sign() > 0 {
+		trade.MakerFee = formatRat(s.MakerFee)
+	}
+	if s.TakerFee != nil && s.TakerFee.Sign() > 0 {
+		trade.TakerFee = formatRat(s.TakerFee)
+	}
+	return trade
+}
+
+// settleResting records the resting order after a fill in delta: as Removed
+// if it is fully filled or waited for the fill to be canceled, as Updated
+// otherwise. Must be called with b.mu held.
+func (b *Book) settleResting(o *bookOrder, delta *message.OrderBookDelta) {
+	if o.remaining.Sign() == 0 {
+		b.removeOrder(o, message.RemoveFilled, delta)
+		return
+	}
+	if reason := b.closing(o); reason != "" {
+		o.order.Status = message.OrderCanceled
+		b.removeOrder(o, reason, delta)
+		return
+	}
+	delta.Updated = append(delta.Updated, o.row())
+}
+
+// AbortFill releases the reservation after the channel update failed or was
+// rejected, so the maker order is matchable again. The amount goes back to
+// the taker: to the resting taker of an auction or the incoming order that
+// rests in the book. An incoming order that was matched completely on arrival
+// is placed in the book with it if its time in force allows; otherwise the
+// amount is canceled and reported in f.Canceled. Orders whose channel became
+// final or that were to be canceled meanwhile are canceled instead.
+func (b *Book) AbortFill(f *Fill) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var delta message.OrderBookDelta
+	for _, o := range []*bookOrder{f.maker, f.taker} {
+		if o == nil {
+			continue
+		}
+		o.reserved.Sub(o.reserved, f.Amount)
+		if _, ok := b.orders[o.order.ID]; !ok {
+			continue
+		}
+		if reason := b.closing(o); reason != "" {
+			o.order.Status = message.OrderCanceled
+			b.removeOrder(o, reason, &delta)
+		}
+	}
+	if f.incoming != nil {
+		f.Canceled = b.restoreTaker(f.incoming, f.Amount, &delta)
+	}
+
+	if f.batch != nil {
+		b.persistPending(delta)
+		f.batch.abort(delta)
+		b.finishFill(f.batch)
+	} else if len(delta.Added) > 0 || len(delta.Updated) > 0 || len(delta.Removed) > 0 {
+		b.publish(delta)
+	}
+}
+
+// restoreTaker gives the amount of an aborted fill back to the incoming order
+// that took it and returns the part that is canceled instead, or nil. Must be
+// called with b.mu held.
+func (b *Book) restoreTaker(t *bookOrder, amount *big.Rat, delta *message.OrderBookDelta) *big.Rat {
+	if _, ok := b.orders[t.order.ID]; ok {
+		if b.closing(t) != "" {
+			return new(big.Rat).Set(amount)
+		}
+		t.remaining.Add(t.remaining, amount)
+		b.lockQty(t, amount)
+		delta.Updated = append(delta.Updated, t.row())
+		return nil
+	}
+	if t.left || !rests(t.order) || b.checkOpen(t.order.ChannelID) != "" || isExpired(t.order, time.Now().Unix()) {
+		return new(big.Rat).Set(amount)
+	}
+	t.remaining.Set(amount)
+	b.marketFor(t.order).own(t.order.Side).insert(t)
+	b.orders[t.order.ID] = t
+	b.lockFunds(t)
+	b.totalOpen++
+	delta.Added = append(delta.Added, t.row())
+	return nil
+}
@@ -0,0 +1,96 @@
+package orderbook
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+// fundKey identifies the balance of one channel participant in one asset.
+type fundKey struct {
+	channel channel.ID
+	maker   channel.Index
+	asset   string
+}
+
+// committedKey returns the maker balance that backs the order.
+func committedKey(o message.Order) fundKey {
+	return fundKey{o.ChannelID, o.MakerIdx, assetKey(CommittedAsset(o))}
+}
+
+// commitment returns the balance an order commits for qty of its base amount:
+// the base amount itself for asks and its price in the quote asset for bids.
+func commitment(o message.Order, price, qty *big.Rat) (fundKey, *big.Rat) {
+	if o.Side == message.SideBid {
+		return committedKey(o), new(big.Rat).Mul(qty, price)
+	}
+	return committedKey(o), new(big.Rat).Set(qty)
+}
+
+// CommittedAsset returns the asset whose balance backs the order: the base
+// asset for asks and the quote asset for bids.
+func CommittedAsset(o message.Order) message.Asset {
+	if o.Side == message.SideBid {
+		return o.Quote
+	}
+	return o.Base
+}
+
+// freeFunds returns the part of balance that is not yet committed to open
+// orders of the maker. Must be called with b.mu held.
+func (b *Book) freeFunds(key fundKey, balance *big.Rat) *big.Rat {
+	free := new(big.Rat).Set(balance)
+	if locked, ok := b.funds[key]; ok {
+		free.Sub(free, locked)
+	}
+	return free
+}
+
+// checkFunds returns the reason for rejecting an order that commits need of
+// the maker's balance, or "" if the balance covers it on top of the maker's
+// open orders. Must be called with b.mu held.
+func (b *Book) checkFunds(key fundKey, need, balance *big.Rat) string {
+	free := b.freeFunds(key, balance)
+	if need.Cmp(free) <= 0 {
+		return ""
+	}
+	if free.Sign() < 0 {
+		free.SetInt64(0)
+	}
+	return fmt.Sprintf("insufficient balance: order commits %s of %s, only %s available",
+		formatRat(need), key.asset, formatRat(free))
+}
+
+// lockFunds commits the balance for the remaining amount of a resting order.
+// Must be called with b.mu held.
+func (b *Book) lockFunds(o *bookOrder) {
+	b.lockQty(o, o.remaining)
+}
+
+// lockQty commits the balance for qty of the order. Must be called with b.mu
+// held.
+func (b *Book) lockQty(o *bookOrder, qty *big.Rat) {
+	key, amt := commitment(o.order, o.price, qty)
+	locked, ok := b.funds[key]
+	if !ok {
+		locked = new(big.Rat)
+		b.funds[key] = locked
+	}
+	locked.Add(locked, amt)
+}
+
+// releaseFunds returns the balance committed for qty of the order once it is
+// filled or leaves the book. Must be called with b.mu held.
+func (b *Book) releaseFunds(o *bookOrder, qty *big.Rat) {
+	key, amt := commitment(o.order, o.price, qty)
+	locked, ok := b.funds[key]
+	if !ok {
+		return
+	}
+	locked.Sub(locked, amt)
+	if locked.Sign() <= 0 {
+		delete(b.funds, key)
+	}
+}
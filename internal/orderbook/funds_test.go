@@ -0,0 +1,139 @@
+package orderbook
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+// locked returns the balance of the asset committed to the open orders of the
+// maker.
+func locked(b *Book, maker channel.Index, asset message.Asset) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if l, ok := b.funds[fundKey{b.chID, maker, assetKey(asset)}]; ok {
+		return formatRat(l)
+	}
+	return "0"
+}
+
+func TestLockedFunds(t *testing.T) {
+	expiry := time.Now().Unix() + 60
+	tests := []struct {
+		name string
+		run  func(t *testing.T, b *Book)
+		// base is the base asset locked by maker 1, quote the quote asset
+		// locked by maker 0.
+		base, quote string
+	}{
+		{
+			name:  "resting orders",
+			run:   func(t *testing.T, b *Book) { createOrders(t, b, ask(1, "10", "3"), bid(0, "9", "2")) },
+			base:  "3",
+			quote: "18",
+		},
+		{
+			name: "canceled",
+			run: func(t *testing.T, b *Book) {
+				ids := createOrders(t, b, ask(1, "10", "3"), bid(0, "9", "2"))
+				b.CancelOrder(ids[0], channel.ID{1}, 1)
+				b.CancelOrder(ids[1], channel.ID{1}, 0)
+			},
+			base:  "0",
+			quote: "0",
+		},
+		{
+			name: "partially filled",
+			run: func(t *testing.T, b *Book) {
+				createOrders(t, b, ask(1, "10", "3"))
+				execute(t, b, bid(0, "10", "1"))
+			},
+			base:  "2",
+			quote: "0",
+		},
+		{
+			name: "taker remainder rests",
+			run: func(t *testing.T, b *Book) {
+				createOrders(t, b, ask(1, "10", "1"))
+				execute(t, b, bid(0, "10", "3"))
+			},
+			base:  "0",
+			quote: "20",
+		},
+		{
+			name: "aborted fill",
+			run: func(t *testing.T, b *Book) {
+				createOrders(t, b, ask(1, "10", "3"))
+				_, fills := submit(t, b, bid(0, "10", "1"))
+				for _, f := range fills {
+					b.AbortFill(f)
+				}
+			},
+			// The bid rests with the amount it got back.
+			base:  "3",
+			quote: "10",
+		},
+		{
+			name: "expired",
+			run: func(t *testing.T, b *Book) {
+				o := ask(1, "10", "3")
+				o.ExpiresAt = &expiry
+				createOrders(t, b, o)
+				b.expire(expiry)
+			},
+			base:  "0",
+			quote: "0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			tt.run(t, b)
+			if got := locked(b, 1, testBase); got != tt.base {
+				t.Errorf("base locked %s, want %s", got, tt.base)
+			}
+			if got := locked(b, 0, testQuote); got != tt.quote {
+				t.Errorf("quote locked %s, want %s", got, tt.quote)
+			}
+		})
+	}
+}
+
+func TestBalanceCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		resting  []message.Order
+		order    message.Order
+		balance  string
+		accepted bool
+	}{
+		{name: "within balance", order: ask(1, "10", "5"), balance: "5", accepted: true},
+		{name: "exceeds balance", order: ask(1, "10", "5.5"), balance: "5"},
+		{name: "bid commits the quote amount", order: bid(1, "10", "2"), balance: "20", accepted: true},
+		{name: "bid exceeds the quote balance", order: bid(1, "10", "2.5"), balance: "20"},
+		{name: "open orders count", resting: []message.Order{ask(1, "12", "3")}, order: ask(1, "10", "3"), balance: "5"},
+		{name: "rest of the balance", resting: []message.Order{ask(1, "12", "3")}, order: ask(1, "10", "2"), balance: "5", accepted: true},
+		{name: "other side does not count", resting: []message.Order{bid(1, "1", "3")}, order: ask(1, "10", "5"), balance: "5", accepted: true},
+		{name: "other maker does not count", resting: []message.Order{ask(0, "12", "3")}, order: ask(1, "10", "5"), balance: "5", accepted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			createOrders(t, b, tt.resting...)
+			balance, _ := new(big.Rat).SetString(tt.balance)
+			ack, _ := submitFunded(t, b, tt.order, balance)
+			if ack.Accepted != tt.accepted {
+				t.Fatalf("accepted %t (%s), want %t", ack.Accepted, ack.Reason, tt.accepted)
+			}
+			if !tt.accepted && !strings.HasPrefix(ack.Reason, "insufficient balance") {
+				t.Errorf("reason %q", ack.Reason)
+			}
+		})
+	}
+}
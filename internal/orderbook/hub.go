@@ -0,0 +1,125 @@
+package orderbook
+
+import (
+	"encoding/hex"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/log"
+	"perun.network/go-perun/wallet"
+)
+
+// hubDomain separates the IDs of consolidated books from channel IDs.
+const hubDomain = "PerunDEXHub/v1"
+
+// HubBookID returns the ID of the consolidated book of the hub with the given
+// L2 address.
+func HubBookID(hub wallet.Address) channel.ID {
+	data, err := hub.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	return channel.ID(crypto.Keccak256Hash([]byte(hubDomain), data))
+}
+
+// EnableHub switches the hub with the given L2 address to consolidated mode:
+// the orders of all channels routed to the hub with RouteChannel share one
+// book, which holds a market per asset pair. Fills in this book are settled
+// in two channels, between the taker and the hub and between the hub and the
+// maker. A book persisted under the hub's ID is resumed.
+func (e *Engine) EnableHub(hub wallet.Address) *Book {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if b, ok := e.hubs[hub.String()]; ok {
+		return b
+	}
+	b := e.getOrCreateBook(HubBookID(hub))
+	b.mu.Lock()
+	b.hub = hub
+	b.settings.Hub = hub.String()
+	b.saveSettings()
+	b.mu.Unlock()
+	e.hubs[hub.String()] = b
+	return b
+}
+
+// HubBook returns the consolidated book of the hub if it is in consolidated
+// mode.
+func (e *Engine) HubBook(hub wallet.Address) (*Book, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	b, ok := e.hubs[hub.String()]
+	return b, ok
+}
+
+// RouteChannel sends the orders of the channel to the consolidated book of
+// hub from now on. It reports whether the channel is routed, which is not the
+// case if the hub is not in consolidated mode or the channel's own book still
+// has open orders.
+func (e *Engine) RouteChannel(chID channel.ID, hub wallet.Address) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	hb, ok := e.hubs[hub.String()]
+	if !ok {
+		return false
+	}
+	if b, ok := e.routes[chID]; ok {
+		return b == hb
+	}
+	if b, ok := e.books[chID]; ok && b.open() > 0 {
+		log.Warnf("order book %x: not joining the consolidated book of hub %v, channel has open orders", chID, hub)
+		return false
+	}
+	e.routes[chID] = hb
+	hb.mu.Lock()
+	hb.settings.Routes = append(hb.settings.Routes, hex.EncodeToString(chID[:]))
+	hb.saveSettings()
+	hb.mu.Unlock()
+	return true
+}
+
+// unrouteChannel removes the channel from the persisted routes of the
+// consolidated book. Must be called with b.mu held.
+func (b *Book) unrouteChannel(chID channel.ID) {
+	name := hex.EncodeToString(chID[:])
+	for i, r := range b.settings.Routes {
+		if r == name {
+			b.settings.Routes = append(b.settings.Routes[:i], b.settings.Routes[i+1:]...)
+			b.saveSettings()
+			return
+		}
+	}
+}
+
+// restoreHub registers a consolidated book restored from disk and the
+// channels routed to it. Must be called with e.mu held.
+func (e *Engine) restoreHub(b *Book) {
+	e.hubs[b.hub.String()] = b
+	for _, r := range b.settings.Routes {
+		var chID channel.ID
+		bs, err := hex.DecodeString(r)
+		if err != nil || len(bs) != len(chID) {
+			log.Warnf("order book %x: skipping invalid route %q", b.chID, r)
+			continue
+		}
+		copy(chID[:], bs)
+		e.routes[chID] = b
+	}
+}
+
+// Hub returns the L2 address of the hub whose channels share the book, or nil
+// if the book belongs to a single channel.
+func (b *Book) Hub() wallet.Address {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.hub
+}
+
+// open returns the number of open and waiting stop orders.
+func (b *Book) open() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.orders) + len(b.stops)
+}
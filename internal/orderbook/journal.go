@@ -0,0 +1,181 @@
+package orderbook
+
+import (
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+)
+
+// JournalSize is the number of past deltas a book keeps for replay.
+const JournalSize = 1024
+
+// journal is a ring buffer of the most recent deltas of a book. Deltas are
+// appended in sequence order without gaps.
+type journal struct {
+	deltas []message.OrderBookDelta
+	start  int
+	n      int
+}
+
+func newJournal(size int) *journal {
+	return &journal{deltas: make([]message.OrderBookDelta, size)}
+}
+
+// append adds a delta and evicts the oldest one if the journal is full.
+func (j *journal) append(d message.OrderBookDelta) {
+	if j.n < len(j.deltas) {
+		j.deltas[(j.start+j.n)%len(j.deltas)] = d
+		j.n++
+		return
+	}
+	j.deltas[j.start] = d
+	j.start = (j.start + 1) % len(j.deltas)
+}
+
+// since returns all deltas with a sequence greater than seq. It returns false
+// if some of them are no longer kept.
+func (j *journal) since(seq uint64) ([]message.OrderBookDelta, bool) {
+	if j.n == 0 {
+		return nil, true
+	}
+	oldest := j.deltas[j.start].Sequence
+	if seq+1 < oldest {
+		return nil, false
+	}
+
+	var out []message.OrderBookDelta
+	for i := 0; i < j.n; i++ {
+		d := j.deltas[(j.start+i)%len(j.deltas)]
+		if d.Sequence > seq {
+			out = append(out, d)
+		}
+	}
+	return out, true
+}
+
+// DeltasSince returns the deltas published after seq in order. It returns
+// false if seq is unknown to the book or has already fallen out of the
+// journal, in which case the caller needs a snapshot.
+func (b *Book) DeltasSince(seq uint64) ([]message.OrderBookDelta, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.deltasSince(seq)
+}
+
+// deltasSince is DeltasSince with b.mu held.
+func (b *Book) deltasSince(seq uint64) ([]message.OrderBookDelta, bool) {
+	if seq > b.sequence {
+		return nil, false
+	}
+	return b.journal.since(seq)
+}
+
+// DeltaSince returns everything that changed after seq merged into a single
+// delta carrying the current sequence.
+func (b *Book) DeltaSince(seq uint64) (message.OrderBookDelta, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	deltas, ok := b.deltasSince(seq)
+	if !ok {
+		return message.OrderBookDelta{}, false
+	}
+	merged := mergeDeltas(deltas)
+	merged.ChannelID = b.chID
+	merged.Sequence = b.sequence
+	merged.TotalOpen = b.totalOpen
+	return merged, true
+}
+
+// SubscribeSince subscribes to future deltas and returns what the subscriber
+// missed after seq. If the journal cannot cover seq, a snapshot is returned
+// instead of the deltas. Both happen atomically so that no delta is lost
+// between catching up and the live stream.
+func (b *Book) SubscribeSince(seq uint64) (*Subscription, *message.OrderBookSnapshot, []message.OrderBookDelta) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := b.subscribe()
+	if seq > 0 {
+		if deltas, ok := b.deltasSince(seq); ok {
+			return sub, nil, deltas
+		}
+	}
+	snap := b.snapshot()
+	return sub, &snap, nil
+}
+
+// mergeDeltas folds consecutive deltas into one that has the same effect.
+// Orders added and removed within the range are left out entirely.
+func mergeDeltas(deltas []message.OrderBookDelta) message.OrderBookDelta {
+	type change struct {
+		kind   string
+		row    message.Order
+		reason message.RemoveReason
+	}
+	const (
+		added   = "added"
+		updated = "updated"
+		removed = "removed"
+	)
+
+	var ids []message.OrderID
+	changes := make(map[message.OrderID]*change)
+	get := func(id message.OrderID) *change {
+		c, ok := changes[id]
+		if !ok {
+			c = &change{}
+			changes[id] = c
+			ids = append(ids, id)
+		}
+		return c
+	}
+
+	for _, d := range deltas {
+		for _, o := range d.Added {
+			c := get(o.ID)
+			// An order that was removed and added again replaces the
+			// subscriber's row.
+			if c.kind == removed {
+				c.kind = updated
+			} else {
+				c.kind = added
+			}
+			c.row = o
+		}
+		for _, o := range d.Updated {
+			c := get(o.ID)
+			if c.kind != added {
+				c.kind = updated
+			}
+			c.row = o
+		}
+		for _, id := range d.Removed {
+			c := get(id)
+			if c.kind == added {
+				c.kind = ""
+				continue
+			}
+			c.kind = removed
+			c.reason = d.Reasons[id]
+		}
+	}
+
+	var merged message.OrderBookDelta
+	for _, id := range ids {
+		c := changes[id]
+		switch c.kind {
+		case added:
+			merged.Added = append(merged.Added, c.row)
+		case updated:
+			merged.Updated = append(merged.Updated, c.row)
+		case removed:
+			merged.Removed = append(merged.Removed, id)
+			if c.reason != "" {
+				if merged.Reasons == nil {
+					merged.Reasons = make(map[message.OrderID]message.RemoveReason)
+				}
+				merged.Reasons[id] = c.reason
+			}
+		}
+	}
+	return merged
+}
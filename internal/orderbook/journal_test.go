@@ -0,0 +1,159 @@
+package orderbook
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+func row(id message.OrderID, remaining string) message.Order {
+	return message.Order{ID: id, Remaining: remaining}
+}
+
+func added(rows ...message.Order) message.OrderBookDelta {
+	return message.OrderBookDelta{Added: rows}
+}
+
+func updated(rows ...message.Order) message.OrderBookDelta {
+	return message.OrderBookDelta{Updated: rows}
+}
+
+func removed(id message.OrderID, reason message.RemoveReason) message.OrderBookDelta {
+	return message.OrderBookDelta{
+		Removed: []message.OrderID{id},
+		Reasons: map[message.OrderID]message.RemoveReason{id: reason},
+	}
+}
+
+// describe renders the changes of a delta in a compact form for comparison.
+func describe(d message.OrderBookDelta) string {
+	var parts []string
+	for _, o := range d.Added {
+		parts = append(parts, fmt.Sprintf("+%s:%s", o.ID, o.Remaining))
+	}
+	for _, o := range d.Updated {
+		parts = append(parts, fmt.Sprintf("~%s:%s", o.ID, o.Remaining))
+	}
+	for _, id := range d.Removed {
+		parts = append(parts, fmt.Sprintf("-%s:%s", id, d.Reasons[id]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestMergeDeltas(t *testing.T) {
+	tests := []struct {
+		name   string
+		deltas []message.OrderBookDelta
+		want   string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "added and updated stays added",
+			deltas: []message.OrderBookDelta{added(row("a", "3")), updated(row("a", "2"))},
+			want:   "+a:2",
+		},
+		{
+			name:   "added and removed is left out",
+			deltas: []message.OrderBookDelta{added(row("a", "3")), updated(row("a", "2")), removed("a", message.RemoveFilled)},
+			want:   "",
+		},
+		{
+			name:   "removed and added again is updated",
+			deltas: []message.OrderBookDelta{removed("a", message.RemoveCanceled), added(row("a", "5"))},
+			want:   "~a:5",
+		},
+		{
+			name:   "updates keep the last row",
+			deltas: []message.OrderBookDelta{updated(row("a", "3")), updated(row("a", "1"))},
+			want:   "~a:1",
+		},
+		{
+			name:   "updated and removed keeps the reason",
+			deltas: []message.OrderBookDelta{updated(row("a", "3")), removed("a", message.RemoveExpired)},
+			want:   "-a:expired",
+		},
+		{
+			name: "orders keep their first appearance",
+			deltas: []message.OrderBookDelta{
+				added(row("a", "1"), row("b", "2")),
+				removed("c", message.RemoveCanceled),
+				updated(row("d", "4"), row("a", "0.5")),
+			},
+			want: "+a:0.5 +b:2 ~d:4 -c:canceled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describe(mergeDeltas(tt.deltas)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJournalSince(t *testing.T) {
+	const size = 4
+	tests := []struct {
+		name     string
+		appended uint64 // deltas 1..appended are appended
+		seq      uint64
+		want     []uint64
+		ok       bool
+	}{
+		{name: "empty", appended: 0, seq: 0, ok: true},
+		{name: "all", appended: 3, seq: 0, want: []uint64{1, 2, 3}, ok: true},
+		{name: "tail", appended: 3, seq: 2, want: []uint64{3}, ok: true},
+		{name: "up to date", appended: 3, seq: 3, ok: true},
+		{name: "oldest kept after eviction", appended: 6, seq: 2, want: []uint64{3, 4, 5, 6}, ok: true},
+		{name: "evicted", appended: 6, seq: 1, ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := newJournal(size)
+			for seq := uint64(1); seq <= tt.appended; seq++ {
+				j.append(message.OrderBookDelta{Sequence: seq})
+			}
+			deltas, ok := j.since(tt.seq)
+			if ok != tt.ok {
+				t.Fatalf("ok = %t, want %t", ok, tt.ok)
+			}
+			var got []uint64
+			for _, d := range deltas {
+				got = append(got, d.Sequence)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got sequences %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeltaSince(t *testing.T) {
+	b := NewEngine().GetOrCreateBook(channel.ID{1})
+	seq := b.Snapshot().Sequence
+	ids := createOrders(t, b, ask(1, "10", "3"), ask(1, "11", "1"))
+	if ack := b.CancelOrder(ids[1], channel.ID{1}, 1); !ack.Success {
+		t.Fatalf("cancel failed: %s", ack.Reason)
+	}
+
+	d, ok := b.DeltaSince(seq)
+	if !ok {
+		t.Fatal("journal does not cover the sequence")
+	}
+	if got, want := describe(d), fmt.Sprintf("+%s:3", ids[0]); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if d.Sequence != b.Snapshot().Sequence {
+		t.Errorf("merged delta has sequence %d, want the book's %d", d.Sequence, b.Snapshot().Sequence)
+	}
+	if _, ok := b.DeltaSince(d.Sequence + 1); ok {
+		t.Error("future sequence accepted")
+	}
+}
@@ -0,0 +1,248 @@
+package orderbook
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/log"
+)
+
+// archiveDir is the directory below the engine's directory that holds the
+// books of closed channels.
+const archiveDir = "archive"
+
+// FinalizeChannel cancels the orders of the channel in its book once the
+// channel state is final. Channels without a book have no orders to cancel.
+func (e *Engine) FinalizeChannel(chID channel.ID) {
+	if b, ok := e.GetBook(chID); ok {
+		b.FinalizeChannel(chID)
+	}
+}
+
+// CancelMakerOrders cancels the orders of the maker at index maker in channel
+// chID in the channel's book, if it has one.
+func (e *Engine) CancelMakerOrders(chID channel.ID, maker channel.Index, reason message.RemoveReason) {
+	if b, ok := e.GetBook(chID); ok {
+		b.CancelMakerOrders(chID, maker, reason)
+	}
+}
+
+// ArchiveChannel archives the book of a closed channel. Its remaining orders
+// are canceled, and the book is evicted from memory and stays readable, but
+// rejects new orders. Persisted books are moved to the archive directory and
+// read from there on demand; books of an engine without a directory are
+// dropped and read as empty. A channel that is routed to a consolidated book
+// only leaves it; the consolidated book stays open.
+func (e *Engine) ArchiveChannel(chID channel.ID) {
+	e.mu.Lock()
+	if _, ok := e.archived[chID]; ok {
+		e.mu.Unlock()
+		return
+	}
+	if hb, ok := e.routes[chID]; ok {
+		hb.FinalizeChannel(chID)
+		hb.mu.Lock()
+		hb.unrouteChannel(chID)
+		hb.mu.Unlock()
+		delete(e.routes, chID)
+	}
+
+	b, ok := e.books[chID]
+	if !ok {
+		b = newBook(chID)
+	}
+	b.FinalizeChannel(chID)
+	b.archive()
+	delete(e.books, chID)
+	// Queries read the closed book from memory until it is in the archive.
+	e.archived[chID] = b
+	e.mu.Unlock()
+
+	b.closeStore()
+	if e.dir != "" {
+		name := hex.EncodeToString(chID[:])
+		if err := os.MkdirAll(filepath.Join(e.dir, archiveDir), 0o700); err != nil {
+			log.Errorf("order book %x: creating archive directory: %v", chID, err)
+		} else if err := os.Rename(filepath.Join(e.dir, name), filepath.Join(e.dir, archiveDir, name)); err != nil && !os.IsNotExist(err) {
+			log.Errorf("order book %x: moving book to archive: %v", chID, err)
+		}
+	}
+
+	e.mu.Lock()
+	e.archived[chID] = nil
+	e.mu.Unlock()
+}
+
+// archivedBook returns the read-only book of a closed channel. Books of a
+// persisted engine are read from disk outside of e.mu and cached, those of
+// an engine without a directory are empty.
+func (e *Engine) archivedBook(chID channel.ID) (*Book, bool) {
+	e.mu.RLock()
+	b, ok := e.archived[chID]
+	e.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	if b != nil {
+		return b, true
+	}
+	if e.dir == "" {
+		b = newBook(chID)
+		b.closed = true
+		return b, true
+	}
+	b, err := e.archive.get(chID, e.loadArchivedBook)
+	if err != nil {
+		log.Errorf("order book %x: reading archived book: %v", chID, err)
+		b = newBook(chID)
+		b.closed = true
+	}
+	return b, true
+}
+
+// loadArchivedBook reads an archived book from disk. Channels that never had a
+// persisted book of their own have an empty one.
+func (e *Engine) loadArchivedBook(chID channel.ID) (*Book, error) {
+	dir := filepath.Join(e.dir, archiveDir, hex.EncodeToString(chID[:]))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		b := newBook(chID)
+		b.closed = true
+		return b, nil
+	}
+	b, err := e.openBookAt(chID, dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.store.close(); err != nil {
+		log.Warnf("order book %x: closing archived store: %v", chID, err)
+	}
+	b.store = nil
+	b.closed = true
+	return b, nil
+}
+
+// FinalizeChannel cancels all orders and waiting stop orders of the channel,
+// as its state is final and cannot be updated with fills anymore. New orders
+// of the channel are rejected. Orders with a pending fill are canceled once
+// the fill is committed or aborted.
+func (b *Book) FinalizeChannel(chID channel.ID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.final[chID]; ok {
+		return
+	}
+	b.final[chID] = struct{}{}
+	b.cancelWhere(func(o message.Order) bool {
+		return o.ChannelID == chID
+	}, message.RemoveChannelFinal)
+}
+
+// CancelMakerOrders cancels all orders and waiting stop orders of the maker at
+// index maker in channel chID for the given reason. Orders with a pending fill
+// are no longer matched and canceled once the fill is committed or aborted.
+func (b *Book) CancelMakerOrders(chID channel.ID, maker channel.Index, reason message.RemoveReason) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cancelWhere(func(o message.Order) bool {
+		return o.ChannelID == chID && o.MakerIdx == maker
+	}, reason)
+}
+
+// cancelWhere removes the waiting stop orders and cancels the orders that
+// match, publishing the canceled orders in one delta. Must be called with
+// b.mu held.
+func (b *Book) cancelWhere(match func(message.Order) bool, reason message.RemoveReason) {
+	var stops []message.OrderID
+	for _, s := range b.stops {
+		if match(s.order) {
+			stops = append(stops, s.order.ID)
+		}
+	}
+	for _, id := range stops {
+		b.removeStop(id)
+	}
+
+	var matched []*bookOrder
+	for _, o := range b.orders {
+		if match(o.order) {
+			matched = append(matched, o)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].order.ID < matched[j].order.ID
+	})
+
+	var delta message.OrderBookDelta
+	for _, o := range matched {
+		b.cancelResting(o, reason, &delta)
+	}
+	if len(delta.Removed) > 0 {
+		b.publish(delta)
+	}
+}
+
+// cancelResting cancels the resting order for the given reason and records
+// its removal in delta. An order with a pending fill is no longer matched and
+// canceled once the fill is committed or aborted. Must be called with b.mu
+// held.
+func (b *Book) cancelResting(o *bookOrder, reason message.RemoveReason, delta *message.OrderBookDelta) {
+	if o.reserved.Sign() > 0 {
+		if o.canceling == "" {
+			o.canceling = reason
+		}
+		return
+	}
+	o.order.Status = message.OrderCanceled
+	b.removeOrder(o, reason, delta)
+}
+
+// archive makes the book read-only. The caller detaches it from its store
+// with closeStore.
+func (b *Book) archive() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+}
+
+// checkOpen returns the reason for rejecting orders of the channel, or "".
+// Must be called with b.mu held.
+func (b *Book) checkOpen(chID channel.ID) string {
+	if b.closed {
+		return "channel is closed"
+	}
+	if b.isFinal(chID) {
+		return "channel is final"
+	}
+	return ""
+}
+
+// isFinal reports whether the state of the channel is final. Must be called
+// with b.mu held.
+func (b *Book) isFinal(chID channel.ID) bool {
+	_, ok := b.final[chID]
+	return ok
+}
+
+// withdrawn reports whether the order must not be matched anymore, as its
+// channel is final or it is to be canceled. Must be called with b.mu held.
+func (b *Book) withdrawn(o *bookOrder) bool {
+	return b.isFinal(o.order.ChannelID) || o.canceling != ""
+}
+
+// closing returns the reason to cancel a withdrawn order with once it has no
+// pending fill, or "". Must be called with b.mu held.
+func (b *Book) closing(o *bookOrder) message.RemoveReason {
+	if o.reserved.Sign() > 0 {
+		return ""
+	}
+	if b.isFinal(o.order.ChannelID) {
+		return message.RemoveChannelFinal
+	}
+	return o.canceling
+}
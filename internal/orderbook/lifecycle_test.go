@@ -0,0 +1,164 @@
+package orderbook
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+func TestCancelMakerOrders(t *testing.T) {
+	chID := channel.ID{1}
+	b := NewEngine().GetOrCreateBook(chID)
+	ids := createOrders(t, b, ask(1, "10", "1"), ask(1, "11", "1"), bid(0, "9", "1"))
+	stop := ask(1, "", "1")
+	stop.Type, stop.StopPrice = message.OrderStop, "8"
+	if ack, _ := submit(t, b, stop); !ack.Accepted {
+		t.Fatalf("stop order rejected: %s", ack.Reason)
+	}
+	seq := b.Snapshot().Sequence
+
+	b.CancelMakerOrders(chID, 1, message.RemoveDisconnected)
+
+	deltas, _ := b.DeltasSince(seq)
+	if len(deltas) != 1 {
+		t.Fatalf("published %d deltas, want 1", len(deltas))
+	}
+	d := deltas[0]
+	if len(d.Removed) != 2 {
+		t.Fatalf("removed %v, want both orders of the maker", d.Removed)
+	}
+	for _, id := range ids[:2] {
+		if d.Reasons[id] != message.RemoveDisconnected {
+			t.Errorf("order %s removed with reason %q", id, d.Reasons[id])
+		}
+	}
+	if got := remaining(b, ids[2]); got != "1" {
+		t.Errorf("order of the other participant: remaining %q", got)
+	}
+	if len(b.Snapshot().Asks) != 0 || len(b.stops) != 0 {
+		t.Error("orders of the maker left in the book")
+	}
+}
+
+func TestCancelMakerOrdersWithPendingFill(t *testing.T) {
+	tests := []struct {
+		name   string
+		commit bool
+	}{
+		{name: "fill committed", commit: true},
+		{name: "fill aborted"},
+	}
+
+	chID := channel.ID{1}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(chID)
+			ids := createOrders(t, b, ask(1, "10", "3"))
+			_, fills := submit(t, b, bid(0, "10", "1"))
+			if len(fills) != 1 {
+				t.Fatalf("got %d fills, want 1", len(fills))
+			}
+
+			// The order stays until the fill is settled, but is not matched
+			// anymore.
+			b.CancelMakerOrders(chID, 1, message.RemoveDisconnected)
+			if got := remaining(b, ids[0]); got != "3" {
+				t.Fatalf("remaining %q with a pending fill, want 3", got)
+			}
+			if _, more := submit(t, b, bid(0, "10", "1")); len(more) != 0 {
+				t.Error("order to be canceled matched")
+			}
+			if ack, _ := b.AcceptOrder(ids[0], "1", chID, 0, nil); ack.Accepted || ack.Reason != "order is being canceled" {
+				t.Errorf("accepted %t with reason %q", ack.Accepted, ack.Reason)
+			}
+
+			seq := b.Snapshot().Sequence
+			if tt.commit {
+				b.CommitFill(fills[0], Settlement{})
+			} else {
+				b.AbortFill(fills[0])
+			}
+			if got := remaining(b, ids[0]); got != "" {
+				t.Errorf("remaining %q after the fill settled", got)
+			}
+			deltas, _ := b.DeltasSince(seq)
+			if len(deltas) != 1 || deltas[0].Reasons[ids[0]] != message.RemoveDisconnected {
+				t.Errorf("published %v, want the order removed as disconnected", deltas)
+			}
+		})
+	}
+}
+
+func TestFinalizeChannelWithoutBook(t *testing.T) {
+	e := NewEngine()
+	e.FinalizeChannel(channel.ID{1})
+	if _, ok := e.GetBook(channel.ID{1}); ok {
+		t.Error("book created for a final channel")
+	}
+}
+
+func TestArchiveChannel(t *testing.T) {
+	tests := []struct {
+		name      string
+		persisted bool
+		// trades is the number of trades the archived book has.
+		trades int
+	}{
+		{name: "in memory"},
+		{name: "persisted", persisted: true, trades: 1},
+	}
+
+	chID := channel.ID{1}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEngine()
+			var dir string
+			if tt.persisted {
+				dir = t.TempDir()
+				var err error
+				if e, err = OpenEngine(dir); err != nil {
+					t.Fatal(err)
+				}
+				defer e.Close()
+			}
+			b := e.GetOrCreateBook(chID)
+			createOrders(t, b, ask(1, "10", "2"))
+			execute(t, b, bid(0, "10", "1"))
+
+			e.ArchiveChannel(chID)
+			e.mu.RLock()
+			cached, archived := e.archived[chID]
+			e.mu.RUnlock()
+			if !archived || cached != nil {
+				t.Fatalf("archived %t, in memory %t", archived, cached != nil)
+			}
+			if tt.persisted {
+				name := hex.EncodeToString(chID[:])
+				if _, err := os.Stat(filepath.Join(dir, archiveDir, name)); err != nil {
+					t.Errorf("book not in the archive: %v", err)
+				}
+				if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+					t.Errorf("book left in place: %v", err)
+				}
+			}
+
+			ab, ok := e.GetBook(chID)
+			if !ok {
+				t.Fatal("archived book not found")
+			}
+			if snap := ab.Snapshot(); len(snap.Asks)+len(snap.Bids) != 0 {
+				t.Errorf("archived book has %d open orders", len(snap.Asks)+len(snap.Bids))
+			}
+			if len(ab.trades) != tt.trades {
+				t.Errorf("archived book has %d trades, want %d", len(ab.trades), tt.trades)
+			}
+			if ack, _ := submit(t, ab, ask(1, "10", "1")); ack.Reason != "channel is closed" {
+				t.Errorf("order on archived book: accepted %t with reason %q", ack.Accepted, ack.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package orderbook
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+)
+
+// bookOrder is an order resting in the book together with its parsed price
+// and the base amounts that are filled and still open. The reserved part of
+// the remaining amount is being settled in the channel and cannot be matched
+// again.
+type bookOrder struct {
+	order     message.Order
+	price     *big.Rat
+	remaining *big.Rat
+	filled    *big.Rat
+	reserved  *big.Rat
+	// canceling is the reason to cancel the order with once its pending
+	// fill is settled, if any.
+	canceling message.RemoveReason
+	// left is set once the order left the book or its remainder was
+	// canceled on arrival.
+	left bool
+}
+
+func newBookOrder(o message.Order, price, amount *big.Rat) *bookOrder {
+	return &bookOrder{
+		order:     o,
+		price:     price,
+		remaining: amount,
+		filled:    new(big.Rat),
+		reserved:  new(big.Rat),
+	}
+}
+
+// available returns the part of the remaining amount that is not reserved.
+func (o *bookOrder) available() *big.Rat {
+	return new(big.Rat).Sub(o.remaining, o.reserved)
+}
+
+// row returns the order as it is published in snapshots and deltas.
+func (o *bookOrder) row() message.Order {
+	r := o.order
+	r.Remaining = formatRat(o.remaining)
+	r.Filled = formatRat(o.filled)
+	return r
+}
+
+// fill moves qty from the remaining to the filled amount. A partially filled
+// order is accepted, a fully filled one is filled.
+func (o *bookOrder) fill(qty *big.Rat) {
+	o.remaining.Sub(o.remaining, qty)
+	o.filled.Add(o.filled, qty)
+	if o.remaining.Sign() == 0 {
+		o.order.Status = message.OrderFilled
+	} else {
+		o.order.Status = message.OrderAccepted
+	}
+}
+
+// priceLevel holds all orders of one side at the same price in arrival order.
+type priceLevel struct {
+	price  *big.Rat
+	orders []*bookOrder
+}
+
+// bookSide is one side of a market with its price levels sorted best-first:
+// descending for bids, ascending for asks.
+type bookSide struct {
+	side   message.OrderSide
+	levels []*priceLevel
+}
+
+// better reports whether price a has strictly higher priority than b.
+func (s *bookSide) better(a, b *big.Rat) bool {
+	if s.side == message.SideBid {
+		return a.Cmp(b) > 0
+	}
+	return a.Cmp(b) < 0
+}
+
+// search returns the index of the first level whose price is not better than
+// the given price.
+func (s *bookSide) search(price *big.Rat) int {
+	return sort.Search(len(s.levels), func(i int) bool {
+		return !s.better(s.levels[i].price, price)
+	})
+}
+
+// insert appends the order to the back of its price level, creating the level
+// if needed.
+func (s *bookSide) insert(o *bookOrder) {
+	i := s.search(o.price)
+	if i < len(s.levels) && s.levels[i].price.Cmp(o.price) == 0 {
+		s.levels[i].orders = append(s.levels[i].orders, o)
+		return
+	}
+	lvl := &priceLevel{price: o.price, orders: []*bookOrder{o}}
+	s.levels = append(s.levels, nil)
+	copy(s.levels[i+1:], s.levels[i:])
+	s.levels[i] = lvl
+}
+
+// remove deletes the order from its price level and drops the level once it
+// is empty.
+func (s *bookSide) remove(o *bookOrder) {
+	i := s.search(o.price)
+	if i >= len(s.levels) || s.levels[i].price.Cmp(o.price) != 0 {
+		return
+	}
+	lvl := s.levels[i]
+	for j, lo := range lvl.orders {
+		if lo == o {
+			lvl.orders = append(lvl.orders[:j], lvl.orders[j+1:]...)
+			break
+		}
+	}
+	if len(lvl.orders) == 0 {
+		s.levels = append(s.levels[:i], s.levels[i+1:]...)
+	}
+}
+
+// best returns the level with the highest priority or nil.
+func (s *bookSide) best() *priceLevel {
+	if len(s.levels) == 0 {
+		return nil
+	}
+	return s.levels[0]
+}
+
+// rows returns all orders of the side in priority order.
+func (s *bookSide) rows() []message.Order {
+	var rows []message.Order
+	for _, lvl := range s.levels {
+		for _, o := range lvl.orders {
+			rows = append(rows, o.row())
+		}
+	}
+	return rows
+}
+
+// market holds both sides for a single base/quote pair. Orders only cross
+// with orders of the same pair.
+type market struct {
+	bids *bookSide
+	asks *bookSide
+}
+
+func newMarket() *market {
+	return &market{
+		bids: &bookSide{side: message.SideBid},
+		asks: &bookSide{side: message.SideAsk},
+	}
+}
+
+// own returns the side an order of the given side rests on.
+func (m *market) own(side message.OrderSide) *bookSide {
+	if side == message.SideBid {
+		return m.bids
+	}
+	return m.asks
+}
+
+// opposite returns the side an order of the given side matches against.
+func (m *market) opposite(side message.OrderSide) *bookSide {
+	return m.own(oppositeSide(side))
+}
+
+// oppositeSide returns the side a taker of an order with the given side has.
+func oppositeSide(side message.OrderSide) message.OrderSide {
+	if side == message.SideBid {
+		return message.SideAsk
+	}
+	return message.SideBid
+}
+
+// crosses reports whether a taker at takerPrice is willing to trade at the
+// maker's price. A nil takerPrice is a market order that takes any price.
+func crosses(side message.OrderSide, takerPrice, makerPrice *big.Rat) bool {
+	if takerPrice == nil {
+		return true
+	}
+	if side == message.SideBid {
+		return makerPrice.Cmp(takerPrice) <= 0
+	}
+	return makerPrice.Cmp(takerPrice) >= 0
+}
+
+// marketKey identifies the base/quote pair of an order.
+func marketKey(o message.Order) string {
+	return assetKey(o.Base) + "/" + assetKey(o.Quote)
+}
+
+// assetKey identifies an asset across chains.
+func assetKey(a message.Asset) string {
+	return a.AssetType() + ":" + a.Code()
+}
+
+// maxDecimals bounds the digits formatRat emits for values that are not
+// finite decimals.
+const maxDecimals = 36
+
+// formatRat renders r as a plain decimal string without trailing zeros.
+func formatRat(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	scaled := new(big.Rat).Set(r)
+	ten := big.NewRat(10, 1)
+	prec := 0
+	for !scaled.IsInt() && prec < maxDecimals {
+		scaled.Mul(scaled, ten)
+		prec++
+	}
+	return r.FloatString(prec)
+}
+
+// minRat returns the smaller of a and b.
+func minRat(a, b *big.Rat) *big.Rat {
+	if a.Cmp(b) <= 0 {
+		return a
+	}
+	return b
+}
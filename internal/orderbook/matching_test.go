@@ -0,0 +1,270 @@
+package orderbook
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+var (
+	testBase  = &message.SolanaAsset{Mint: "base"}
+	testQuote = &message.SolanaAsset{Mint: "quote"}
+)
+
+// testOrder returns a good-till-canceled limit order of the participant at
+// maker in the test market.
+func testOrder(side message.OrderSide, maker channel.Index, price, amount string) message.Order {
+	return message.Order{
+		MakerIdx: maker,
+		Side:     side,
+		Base:     testBase,
+		Quote:    testQuote,
+		Price:    price,
+		Amount:   amount,
+	}
+}
+
+func ask(maker channel.Index, price, amount string) message.Order {
+	return testOrder(message.SideAsk, maker, price, amount)
+}
+
+func bid(maker channel.Index, price, amount string) message.Order {
+	return testOrder(message.SideBid, maker, price, amount)
+}
+
+// submit places the order and returns its ack and pending fills.
+func submit(t *testing.T, b *Book, o message.Order) (message.CreateOrderAck, []*Fill) {
+	t.Helper()
+	return submitFunded(t, b, o, nil)
+}
+
+// submitFunded is submit for a maker with the given balance of the order's
+// committed asset.
+func submitFunded(t *testing.T, b *Book, o message.Order, balance *big.Rat) (message.CreateOrderAck, []*Fill) {
+	t.Helper()
+	return b.CreateOrder(o, Admission{Balance: balance})
+}
+
+// execute places the order and commits all of its fills as if their channel
+// updates succeeded, including those of the stop orders they trigger.
+func execute(t *testing.T, b *Book, o message.Order) (message.CreateOrderAck, []message.Trade) {
+	t.Helper()
+	ack, fills := submit(t, b, o)
+	var trades []message.Trade
+	for len(fills) > 0 {
+		trade, triggered := b.CommitFill(fills[0], Settlement{})
+		trades = append(trades, trade)
+		fills = append(fills[1:], triggered...)
+	}
+	return ack, trades
+}
+
+// createOrders places orders that must not match and returns their IDs.
+func createOrders(t *testing.T, b *Book, orders ...message.Order) []message.OrderID {
+	t.Helper()
+	ids := make([]message.OrderID, len(orders))
+	for i, o := range orders {
+		ack, fills := submit(t, b, o)
+		if !ack.Accepted {
+			t.Fatalf("order %d rejected: %s", i, ack.Reason)
+		}
+		if len(fills) > 0 {
+			t.Fatalf("order %d matched", i)
+		}
+		ids[i] = ack.ID
+	}
+	return ids
+}
+
+// remaining returns the remaining amount of the resting order, or "" if it is
+// not in the book.
+func remaining(b *Book, id message.OrderID) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o, ok := b.orders[id]
+	if !ok {
+		return ""
+	}
+	return formatRat(o.remaining)
+}
+
+func TestMatching(t *testing.T) {
+	type trade struct {
+		maker  int // index of the resting order
+		amount string
+		price  string
+	}
+	tests := []struct {
+		name    string
+		resting []message.Order
+		taker   message.Order
+		trades  []trade
+		// left are the remaining amounts of the resting orders once the
+		// trades are settled, "" for removed orders.
+		left  []string
+		rests string
+	}{
+		{
+			name:    "best price first",
+			resting: []message.Order{ask(1, "11", "1"), ask(1, "10", "1")},
+			taker:   bid(0, "11", "2"),
+			trades:  []trade{{1, "1", "10"}, {0, "1", "11"}},
+			left:    []string{"", ""},
+		},
+		{
+			name:    "time priority within a level",
+			resting: []message.Order{ask(1, "10", "1"), ask(1, "10", "1")},
+			taker:   bid(0, "10", "1"),
+			trades:  []trade{{0, "1", "10"}},
+			left:    []string{"", "1"},
+		},
+		{
+			name:    "partial fill of the maker",
+			resting: []message.Order{ask(1, "10", "5")},
+			taker:   bid(0, "12", "2"),
+			trades:  []trade{{0, "2", "10"}},
+			left:    []string{"3"},
+		},
+		{
+			name:    "remainder rests",
+			resting: []message.Order{ask(1, "10", "1")},
+			taker:   bid(0, "10", "3"),
+			trades:  []trade{{0, "1", "10"}},
+			left:    []string{""},
+			rests:   "2",
+		},
+		{
+			name:    "no cross",
+			resting: []message.Order{ask(1, "11", "1")},
+			taker:   bid(0, "10", "1"),
+			left:    []string{"1"},
+			rests:   "1",
+		},
+		{
+			name:    "ask takes the highest bid first",
+			resting: []message.Order{bid(1, "9", "1"), bid(1, "10", "1")},
+			taker:   ask(0, "9", "1.5"),
+			trades:  []trade{{1, "1", "10"}, {0, "0.5", "9"}},
+			left:    []string{"0.5", ""},
+		},
+		{
+			name:    "fractional amounts",
+			resting: []message.Order{ask(1, "0.5", "0.3")},
+			taker:   bid(0, "0.5", "0.1"),
+			trades:  []trade{{0, "0.1", "0.5"}},
+			left:    []string{"0.2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			ids := createOrders(t, b, tt.resting...)
+
+			ack, trades := execute(t, b, tt.taker)
+			if !ack.Accepted {
+				t.Fatalf("taker rejected: %s", ack.Reason)
+			}
+			if len(trades) != len(tt.trades) {
+				t.Fatalf("got %d trades, want %d", len(trades), len(tt.trades))
+			}
+			for i, want := range tt.trades {
+				tr := trades[i]
+				if tr.MakerOrderID != ids[want.maker] || tr.Amount != want.amount || tr.Price != want.price {
+					t.Errorf("trade %d: got %s %s@%s, want order %d %s@%s",
+						i, tr.MakerOrderID, tr.Amount, tr.Price, want.maker, want.amount, want.price)
+				}
+				if tr.TakerOrderID != ack.ID || tr.TakerSide != tt.taker.Side {
+					t.Errorf("trade %d: wrong taker %s %s", i, tr.TakerOrderID, tr.TakerSide)
+				}
+			}
+
+			for i, id := range ids {
+				if got := remaining(b, id); got != tt.left[i] {
+					t.Errorf("resting order %d: remaining %q, want %q", i, got, tt.left[i])
+				}
+			}
+			if got := remaining(b, ack.ID); got != tt.rests {
+				t.Errorf("taker: remaining %q, want %q", got, tt.rests)
+			}
+		})
+	}
+}
+
+func TestReservedAmountsAreNotMatched(t *testing.T) {
+	tests := []struct {
+		name   string
+		commit bool
+		// left is the maker's remaining amount once both fills are
+		// settled.
+		left string
+	}{
+		{name: "committed", commit: true, left: ""},
+		{name: "aborted", commit: false, left: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			ids := createOrders(t, b, ask(1, "10", "3"))
+
+			_, first := submit(t, b, bid(0, "10", "2"))
+			if len(first) != 1 {
+				t.Fatalf("got %d fills, want 1", len(first))
+			}
+			// Only what the pending fill did not reserve is matched.
+			_, second := submit(t, b, bid(0, "10", "2"))
+			if len(second) != 1 || formatRat(second[0].Amount) != "1" {
+				t.Fatalf("second bid matched %v, want 1", second)
+			}
+
+			if tt.commit {
+				b.CommitFill(first[0], Settlement{})
+			} else {
+				b.AbortFill(first[0])
+			}
+			b.CommitFill(second[0], Settlement{})
+			if got := remaining(b, ids[0]); got != tt.left {
+				t.Errorf("maker: remaining %q, want %q", got, tt.left)
+			}
+		})
+	}
+}
+
+func TestAbortFillRestoresTaker(t *testing.T) {
+	tests := []struct {
+		name     string
+		taker    message.Order
+		rests    string
+		canceled string
+	}{
+		{name: "resting remainder", taker: bid(0, "10", "3"), rests: "3"},
+		{name: "completely matched", taker: bid(0, "10", "1"), rests: "1"},
+		{name: "immediate or cancel", taker: withTIF(bid(0, "10", "1"), message.TimeIOC), canceled: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			createOrders(t, b, ask(1, "10", "1"))
+
+			ack, fills := submit(t, b, tt.taker)
+			if len(fills) != 1 {
+				t.Fatalf("got %d fills, want 1", len(fills))
+			}
+			b.AbortFill(fills[0])
+			if got := remaining(b, ack.ID); got != tt.rests {
+				t.Errorf("taker: remaining %q, want %q", got, tt.rests)
+			}
+			canceled := ""
+			if fills[0].Canceled != nil {
+				canceled = formatRat(fills[0].Canceled)
+			}
+			if canceled != tt.canceled {
+				t.Errorf("canceled %q, want %q", canceled, tt.canceled)
+			}
+		})
+	}
+}
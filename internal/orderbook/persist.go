@@ -0,0 +1,584 @@
+package orderbook
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	ethwallet "github.com/perun-network/perun-eth-backend/wallet"
+	"github.com/pkg/errors"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/log"
+)
+
+const (
+	// SnapshotInterval is the default interval in which the engine compacts
+	// the write-ahead logs of changed books into snapshots.
+	SnapshotInterval = time.Minute
+
+	snapshotFile = "snapshot.json"
+	walFile      = "wal.log"
+	triggersFile = "triggers.json"
+	tradesFile   = "trades.log"
+	settingsFile = "settings.json"
+	// maxWALLine bounds the size of a single delta in the write-ahead log.
+	maxWALLine = 16 << 20
+)
+
+// bookStore persists a single book as a snapshot plus a write-ahead log of
+// every delta published after that snapshot.
+type bookStore struct {
+	dir         string
+	wal         *os.File
+	snapshotSeq uint64
+	// trades is the append-only trade log, which is never compacted.
+	trades *os.File
+}
+
+func openBookStore(dir string) (*bookStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "creating book directory")
+	}
+	wal, err := os.OpenFile(filepath.Join(dir, walFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening write-ahead log")
+	}
+	trades, err := os.OpenFile(filepath.Join(dir, tradesFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		wal.Close()
+		return nil, errors.Wrap(err, "opening trade log")
+	}
+	return &bookStore{dir: dir, wal: wal, trades: trades}, nil
+}
+
+// walEntry is a line of the write-ahead log.
+type walEntry struct {
+	message.OrderBookDelta
+	// Pending marks the changes of a settled auction fill, which are logged
+	// right away under the current sequence but published only once the
+	// whole auction is settled.
+	Pending bool `json:"pending,omitempty"`
+}
+
+// load reads the last snapshot, if any, and the deltas logged after it. A
+// truncated last line from an interrupted write is ignored.
+func (s *bookStore) load() (*message.OrderBookSnapshot, []walEntry, error) {
+	var snap *message.OrderBookSnapshot
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	switch {
+	case err == nil:
+		snap = new(message.OrderBookSnapshot)
+		if err := json.Unmarshal(data, snap); err != nil {
+			return nil, nil, errors.Wrap(err, "decoding snapshot")
+		}
+		s.snapshotSeq = snap.Sequence
+	case !os.IsNotExist(err):
+		return nil, nil, errors.Wrap(err, "reading snapshot")
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, walFile))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "reading write-ahead log")
+	}
+	defer f.Close()
+
+	var deltas []walEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), maxWALLine)
+	for sc.Scan() {
+		var d walEntry
+		if err := json.Unmarshal(sc.Bytes(), &d); err != nil {
+			log.Warnf("order book %s: skipping unreadable write-ahead log entry: %v", s.dir, err)
+			break
+		}
+		deltas = append(deltas, d)
+	}
+	return snap, deltas, errors.Wrap(sc.Err(), "scanning write-ahead log")
+}
+
+// loadTrades reads the most recent trades of the trade log, see TradeWindow.
+// A truncated last line from an interrupted write is ignored.
+func (s *bookStore) loadTrades() ([]message.Trade, error) {
+	f, err := os.Open(filepath.Join(s.dir, tradesFile))
+	if err != nil {
+		return nil, errors.Wrap(err, "reading trade log")
+	}
+	defer f.Close()
+
+	var trades []message.Trade
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var t message.Trade
+		if err := json.Unmarshal(sc.Bytes(), &t); err != nil {
+			log.Warnf("order book %s: skipping unreadable trade log entry: %v", s.dir, err)
+			break
+		}
+		trades = trimTrades(append(trades, t))
+	}
+	return trades, errors.Wrap(sc.Err(), "scanning trade log")
+}
+
+// appendTrade logs the trade and syncs it to disk.
+func (s *bookStore) appendTrade(t message.Trade) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if _, err := s.trades.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.trades.Sync()
+}
+
+// append logs the entry and syncs it to disk.
+func (s *bookStore) append(d walEntry) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if _, err := s.wal.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.wal.Sync()
+}
+
+// writeSnapshot atomically replaces the snapshot and truncates the
+// write-ahead log. Deltas that remain in the log after a crash between both
+// steps are skipped on load by their sequence.
+func (s *bookStore) writeSnapshot(snap message.OrderBookSnapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, snapshotFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFile)); err != nil {
+		return err
+	}
+	s.snapshotSeq = snap.Sequence
+	return s.wal.Truncate(0)
+}
+
+// triggers is the persisted state of the hidden stop orders, which is not
+// part of the published deltas.
+type triggers struct {
+	Stops      []message.Order   `json:"stops"`
+	LastPrices map[string]string `json:"lastPrices"`
+}
+
+// loadTriggers reads the stop orders and last trade prices, if any.
+func (s *bookStore) loadTriggers() (triggers, error) {
+	var t triggers
+	data, err := os.ReadFile(filepath.Join(s.dir, triggersFile))
+	if os.IsNotExist(err) {
+		return t, nil
+	} else if err != nil {
+		return t, errors.Wrap(err, "reading triggers")
+	}
+	return t, errors.Wrap(json.Unmarshal(data, &t), "decoding triggers")
+}
+
+// writeTriggers atomically replaces the stop orders and last trade prices.
+func (s *bookStore) writeTriggers(t triggers) error {
+	return s.writeJSON(triggersFile, t)
+}
+
+// settings are the options of a book set by its participants.
+type settings struct {
+	Public bool `json:"public"`
+	// AuctionInterval is the interval of batch auctions in seconds, 0 for
+	// continuous matching.
+	AuctionInterval int64 `json:"auctionInterval,omitempty"`
+	// Hub is the L2 address of the hub if the book is a consolidated book.
+	Hub string `json:"hub,omitempty"`
+	// Routes are the hex encoded IDs of the channels routed to the
+	// consolidated book.
+	Routes []string `json:"routes,omitempty"`
+}
+
+// loadSettings reads the book's settings, if any.
+func (s *bookStore) loadSettings() (settings, error) {
+	var st settings
+	data, err := os.ReadFile(filepath.Join(s.dir, settingsFile))
+	if os.IsNotExist(err) {
+		return st, nil
+	} else if err != nil {
+		return st, errors.Wrap(err, "reading settings")
+	}
+	return st, errors.Wrap(json.Unmarshal(data, &st), "decoding settings")
+}
+
+// writeSettings atomically replaces the book's settings.
+func (s *bookStore) writeSettings(st settings) error {
+	return s.writeJSON(settingsFile, st)
+}
+
+// writeJSON atomically replaces the named file with v encoded as JSON.
+func (s *bookStore) writeJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, name))
+}
+
+func (s *bookStore) close() error {
+	err := s.wal.Close()
+	if tErr := s.trades.Close(); err == nil {
+		err = tErr
+	}
+	return err
+}
+
+// OpenEngine creates an engine that persists every book below dir and
+// restores all books found there.
+func OpenEngine(dir string) (*Engine, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "creating order book directory")
+	}
+	e := NewEngine()
+	e.dir = dir
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading order book directory")
+	}
+	for _, entry := range entries {
+		var chID channel.ID
+		bs, err := hex.DecodeString(entry.Name())
+		if !entry.IsDir() || err != nil || len(bs) != len(chID) {
+			continue
+		}
+		copy(chID[:], bs)
+
+		b, err := e.openBook(chID)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "restoring book %x", chID)
+		}
+		e.books[chID] = b
+		if b.hub != nil {
+			e.restoreHub(b)
+		}
+	}
+
+	// Archived books are only read when they are queried.
+	archived, err := os.ReadDir(filepath.Join(dir, archiveDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "reading archive directory")
+	}
+	for _, entry := range archived {
+		var chID channel.ID
+		bs, err := hex.DecodeString(entry.Name())
+		if !entry.IsDir() || err != nil || len(bs) != len(chID) {
+			continue
+		}
+		copy(chID[:], bs)
+		e.archived[chID] = nil
+	}
+	return e, nil
+}
+
+// openBook creates a book backed by its store below the engine's directory
+// and restores its previous state.
+func (e *Engine) openBook(chID channel.ID) (*Book, error) {
+	return e.openBookAt(chID, filepath.Join(e.dir, hex.EncodeToString(chID[:])))
+}
+
+// openBookAt is openBook for a book stored in dir.
+func (e *Engine) openBookAt(chID channel.ID, dir string) (*Book, error) {
+	store, err := openBookStore(dir)
+	if err != nil {
+		return nil, err
+	}
+	snap, deltas, err := store.load()
+	if err != nil {
+		store.close()
+		return nil, err
+	}
+
+	trig, err := store.loadTriggers()
+	if err != nil {
+		store.close()
+		return nil, err
+	}
+	trades, err := store.loadTrades()
+	if err != nil {
+		store.close()
+		return nil, err
+	}
+	st, err := store.loadSettings()
+	if err != nil {
+		store.close()
+		return nil, err
+	}
+
+	b := newBook(chID)
+	if err := b.restore(snap, deltas); err != nil {
+		store.close()
+		return nil, err
+	}
+	if err := b.restoreTriggers(trig); err != nil {
+		store.close()
+		return nil, err
+	}
+	b.trades = trades
+	b.tradeLog = filepath.Join(dir, tradesFile)
+	b.settings = st
+	if st.Hub != "" {
+		b.hub = ethwallet.AsWalletAddr(common.HexToAddress(st.Hub))
+	}
+	b.store = store
+	return b, nil
+}
+
+// RunSnapshots writes a snapshot of every changed book every interval until
+// the engine is closed.
+func (e *Engine) RunSnapshots(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, b := range e.allBooks() {
+				b.saveSnapshot()
+			}
+		case <-e.closed:
+			return
+		}
+	}
+}
+
+// saveSnapshot compacts the book's write-ahead log if anything changed since
+// the last snapshot.
+func (b *Book) saveSnapshot() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.store == nil || b.sequence == b.store.snapshotSeq {
+		return
+	}
+	if err := b.store.writeSnapshot(b.snapshot()); err != nil {
+		log.Errorf("order book %x: writing snapshot: %v", b.chID, err)
+	}
+}
+
+// closeStore writes a final snapshot and detaches the book from its store.
+func (b *Book) closeStore() {
+	b.saveSnapshot()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.store == nil {
+		return
+	}
+	if err := b.store.close(); err != nil {
+		log.Errorf("order book %x: closing store: %v", b.chID, err)
+	}
+	b.store = nil
+}
+
+// persist appends the delta to the book's write-ahead log. Must be called
+// with b.mu held.
+func (b *Book) persist(delta message.OrderBookDelta) {
+	if b.store == nil {
+		return
+	}
+	if err := b.store.append(walEntry{OrderBookDelta: delta}); err != nil {
+		log.Errorf("order book %x: appending to write-ahead log: %v", b.chID, err)
+	}
+}
+
+// persistPending appends the changes of a settled auction fill to the book's
+// write-ahead log before they are published with the auction, so that they
+// survive a restart in between. Must be called with b.mu held.
+func (b *Book) persistPending(delta message.OrderBookDelta) {
+	if b.store == nil || (len(delta.Updated) == 0 && len(delta.Removed) == 0) {
+		return
+	}
+	delta.ChannelID = b.chID
+	delta.Sequence = b.sequence
+	if err := b.store.append(walEntry{OrderBookDelta: delta, Pending: true}); err != nil {
+		log.Errorf("order book %x: appending to write-ahead log: %v", b.chID, err)
+	}
+}
+
+// saveTriggers persists the stop orders and last trade prices. Must be called
+// with b.mu held.
+func (b *Book) saveTriggers() {
+	if b.store == nil {
+		return
+	}
+	t := triggers{
+		Stops:      make([]message.Order, 0, len(b.stops)),
+		LastPrices: make(map[string]string, len(b.lastPrice)),
+	}
+	for _, s := range b.stops {
+		t.Stops = append(t.Stops, s.row())
+	}
+	for key, price := range b.lastPrice {
+		t.LastPrices[key] = formatRat(price)
+	}
+	if err := b.store.writeTriggers(t); err != nil {
+		log.Errorf("order book %x: writing triggers: %v", b.chID, err)
+	}
+}
+
+// saveSettings persists the book's settings. Must be called with b.mu held.
+func (b *Book) saveSettings() {
+	if b.store == nil {
+		return
+	}
+	if err := b.store.writeSettings(b.settings); err != nil {
+		log.Errorf("order book %x: writing settings: %v", b.chID, err)
+	}
+}
+
+// restore rebuilds the book from a snapshot and the deltas logged after it.
+// The replayed deltas are kept in the journal.
+func (b *Book) restore(snap *message.OrderBookSnapshot, deltas []walEntry) error {
+	if snap != nil {
+		for _, rows := range [][]message.Order{snap.Bids, snap.Asks} {
+			for _, row := range rows {
+				if err := b.restoreOrder(row); err != nil {
+					return err
+				}
+			}
+		}
+		b.sequence = snap.Sequence
+	}
+
+	for _, d := range deltas {
+		// Pending entries were logged under the sequence current at the
+		// time and are applied without being journaled. Applying rows is
+		// idempotent, so entries already contained in the snapshot are
+		// harmless.
+		if d.Pending {
+			if d.Sequence >= b.sequence {
+				if err := b.apply(d.OrderBookDelta); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if d.Sequence <= b.sequence {
+			continue
+		}
+		if err := b.apply(d.OrderBookDelta); err != nil {
+			return err
+		}
+		b.sequence = d.Sequence
+		b.journal.append(d.OrderBookDelta)
+	}
+	b.totalOpen = uint64(len(b.orders))
+	return nil
+}
+
+// apply replays the rows of a persisted delta.
+func (b *Book) apply(d message.OrderBookDelta) error {
+	for _, row := range d.Added {
+		if err := b.restoreOrder(row); err != nil {
+			return err
+		}
+	}
+	for _, row := range d.Updated {
+		o, ok := b.orders[row.ID]
+		if !ok {
+			continue
+		}
+		price, ok := parsePositive(row.Price)
+		if !ok {
+			return errors.Errorf("order %s: invalid price %q", row.ID, row.Price)
+		}
+		remaining, filled, err := parseFillState(row)
+		if err != nil {
+			return err
+		}
+		// Rows of fills and replacements are both applied as an amendment,
+		// which moves replaced orders to their new place.
+		b.amend(o, row, price, remaining)
+		o.order.Status = row.Status
+		o.filled = filled
+	}
+	for _, id := range d.Removed {
+		if o, ok := b.orders[id]; ok {
+			b.removeOrder(o, d.Reasons[id], &message.OrderBookDelta{})
+		}
+	}
+	return nil
+}
+
+// restoreOrder appends a persisted row to the back of its price level.
+func (b *Book) restoreOrder(row message.Order) error {
+	price, ok := parsePositive(row.Price)
+	if !ok {
+		return errors.Errorf("order %s: invalid price %q", row.ID, row.Price)
+	}
+	remaining, filled, err := parseFillState(row)
+	if err != nil {
+		return err
+	}
+	o := newBookOrder(row, price, remaining)
+	o.filled = filled
+	b.marketFor(row).own(row.Side).insert(o)
+	b.orders[row.ID] = o
+	b.lockFunds(o)
+	return nil
+}
+
+// restoreTriggers adds the persisted stop orders back to the trigger list
+// and restores the last trade prices.
+func (b *Book) restoreTriggers(t triggers) error {
+	for key, p := range t.LastPrices {
+		price, ok := parsePositive(p)
+		if !ok {
+			return errors.Errorf("market %s: invalid last price %q", key, p)
+		}
+		b.lastPrice[key] = price
+	}
+	for _, row := range t.Stops {
+		trigger, ok := parsePositive(row.StopPrice)
+		if !ok {
+			return errors.Errorf("order %s: invalid stop price %q", row.ID, row.StopPrice)
+		}
+		price := trigger
+		if row.Type == message.OrderStopLimit {
+			if price, ok = parsePositive(row.Price); !ok {
+				return errors.Errorf("order %s: invalid price %q", row.ID, row.Price)
+			}
+		}
+		remaining, _, err := parseFillState(row)
+		if err != nil {
+			return err
+		}
+		s := &stopOrder{bookOrder: newBookOrder(row, price, remaining), trigger: trigger}
+		b.stops = append(b.stops, s)
+		b.lockFunds(s.bookOrder)
+	}
+	return nil
+}
+
+// parseFillState parses the remaining and filled amounts of a persisted row.
+func parseFillState(row message.Order) (remaining, filled *big.Rat, err error) {
+	remaining, ok := new(big.Rat).SetString(row.Remaining)
+	if !ok {
+		return nil, nil, errors.Errorf("order %s: invalid remaining amount %q", row.ID, row.Remaining)
+	}
+	filled, ok = new(big.Rat).SetString(row.Filled)
+	if !ok {
+		return nil, nil, errors.Errorf("order %s: invalid filled amount %q", row.ID, row.Filled)
+	}
+	return remaining, filled, nil
+}
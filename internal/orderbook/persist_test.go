@@ -0,0 +1,170 @@
+package orderbook
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name string
+		// snapshot compacts the log after the first orders are placed.
+		snapshot bool
+		// crash reopens the engine without the final snapshot written on
+		// close.
+		crash bool
+		// truncate appends a partial line to the log before reopening.
+		truncate bool
+	}{
+		{name: "log only", crash: true},
+		{name: "snapshot and log", snapshot: true, crash: true},
+		{name: "truncated log", crash: true, truncate: true},
+		{name: "snapshot, log and truncated line", snapshot: true, crash: true, truncate: true},
+		{name: "clean close"},
+	}
+
+	chID := channel.ID{1}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			e, err := OpenEngine(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := e.GetOrCreateBook(chID)
+			ids := createOrders(t, b, ask(1, "10", "3"), ask(1, "11", "1"), bid(1, "9", "2"))
+			if tt.snapshot {
+				b.saveSnapshot()
+			}
+
+			ack, trades := execute(t, b, bid(0, "10", "2"))
+			if len(trades) != 1 {
+				t.Fatalf("got %d trades, want 1", len(trades))
+			}
+			if ack := b.CancelOrder(ids[1], chID, 1); !ack.Success {
+				t.Fatalf("cancel failed: %s", ack.Reason)
+			}
+			want := b.Snapshot()
+
+			if tt.crash {
+				b.store.close()
+			} else {
+				e.Close()
+			}
+			if tt.truncate {
+				f, err := os.OpenFile(filepath.Join(dir, hex.EncodeToString(chID[:]), walFile), os.O_APPEND|os.O_WRONLY, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.WriteString(`{"channelId":`)
+				f.Close()
+			}
+
+			e, err = OpenEngine(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer e.Close()
+			b, ok := e.GetBook(chID)
+			if !ok {
+				t.Fatal("book not restored")
+			}
+			got := b.Snapshot()
+			if got.Sequence != want.Sequence || got.TotalOpen != want.TotalOpen {
+				t.Errorf("restored sequence %d with %d orders, want %d with %d",
+					got.Sequence, got.TotalOpen, want.Sequence, want.TotalOpen)
+			}
+			for i, left := range []string{"1", "", "2"} {
+				if r := remaining(b, ids[i]); r != left {
+					t.Errorf("order %d: remaining %q, want %q", i, r, left)
+				}
+			}
+			if r := remaining(b, ack.ID); r != "" {
+				t.Errorf("filled taker restored with %q", r)
+			}
+			if len(b.trades) != 1 {
+				t.Errorf("restored %d trades, want 1", len(b.trades))
+			}
+
+			// The restored book continues the sequence and matches the
+			// restored orders.
+			_, trades = execute(t, b, bid(0, "10", "5"))
+			if len(trades) != 1 || trades[0].MakerOrderID != ids[0] || trades[0].Amount != "1" {
+				t.Fatalf("restored book matched %v", trades)
+			}
+			if seq := b.Snapshot().Sequence; seq <= want.Sequence {
+				t.Errorf("sequence %d did not advance past %d", seq, want.Sequence)
+			}
+		})
+	}
+}
+
+func TestRestoreReplaysJournal(t *testing.T) {
+	dir := t.TempDir()
+	e, err := OpenEngine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chID := channel.ID{1}
+	b := e.GetOrCreateBook(chID)
+	seq := b.Snapshot().Sequence
+	ids := createOrders(t, b, ask(1, "10", "3"))
+	b.store.close()
+
+	e, err = OpenEngine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	b, _ = e.GetBook(chID)
+	deltas, ok := b.DeltasSince(seq)
+	if !ok || len(deltas) != 1 || len(deltas[0].Added) != 1 || deltas[0].Added[0].ID != ids[0] {
+		t.Errorf("restored journal has %v (%t), want the added order", deltas, ok)
+	}
+}
+
+func TestApplyUpdatedRow(t *testing.T) {
+	tests := []struct {
+		name  string
+		row   func(message.Order) message.Order
+		price string
+		left  string
+	}{
+		{
+			name:  "fill",
+			row:   func(o message.Order) message.Order { o.Remaining, o.Filled = "1", "2"; return o },
+			price: "10",
+			left:  "1",
+		},
+		{
+			name:  "replacement",
+			row:   func(o message.Order) message.Order { o.Price, o.Remaining = "12", "5"; return o },
+			price: "12",
+			left:  "5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			ids := createOrders(t, b, ask(1, "10", "3"))
+			o, _ := b.Order(ids[0])
+
+			b.mu.Lock()
+			err := b.apply(message.OrderBookDelta{Updated: []message.Order{tt.row(o)}})
+			b.mu.Unlock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			o, _ = b.Order(ids[0])
+			if o.Price != tt.price || o.Remaining != tt.left {
+				t.Errorf("got %s@%s, want %s@%s", o.Remaining, o.Price, tt.left, tt.price)
+			}
+		})
+	}
+}
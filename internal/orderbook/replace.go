@@ -0,0 +1,157 @@
+package orderbook
+
+import (
+	"math/big"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+// Order returns the resting order with the given ID as it is published in
+// snapshots.
+func (b *Book) Order(id message.OrderID) (message.Order, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	o, ok := b.orders[id]
+	if !ok {
+		return message.Order{}, false
+	}
+	return o.row(), true
+}
+
+// ReplaceOrder changes the price and amount of the resting order o.ID of the
+// maker at index maker in channel chID to those of o, which carries the
+// order's new nonce and signature. All other terms must stay the same. The
+// order keeps its ID and, if only its amount goes down, its place in the
+// price level; otherwise it moves to the back of its new level. Outside of
+// auction mode, a replacement that would cross an amount the book would match
+// is rejected, in auction mode one that would cross an order of the same
+// trader. The change is published as a single Updated delta.
+func (b *Book) ReplaceOrder(o message.Order, chID channel.ID, maker channel.Index, adm Admission) message.ReplaceOrderAck {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	reject := func(reason string) message.ReplaceOrderAck {
+		return message.ReplaceOrderAck{
+			ID:        o.ID,
+			Success:   false,
+			Reason:    reason,
+			TotalOpen: b.totalOpen,
+		}
+	}
+
+	cur, ok := b.orders[o.ID]
+	if !ok {
+		if _, ok := b.findStop(o.ID); ok {
+			return reject("waiting stop orders cannot be replaced")
+		}
+		return reject("order not found")
+	}
+	if cur.order.ChannelID != chID || cur.order.MakerIdx != maker {
+		return reject("only the maker can replace the order")
+	}
+	if reason := b.checkOpen(chID); reason != "" {
+		return reject(reason)
+	}
+	if cur.reserved.Sign() > 0 {
+		return reject("order has a pending fill")
+	}
+	if !sameTerms(cur.order, o) {
+		return reject("only price and amount can be replaced")
+	}
+	o.Trader = cur.order.Trader
+	price, ok := parsePositive(o.Price)
+	if !ok {
+		return reject("invalid price")
+	}
+	amount, ok := parsePositive(o.Amount)
+	if !ok {
+		return reject("invalid amount")
+	}
+	if amount.Cmp(cur.filled) <= 0 {
+		return reject("amount must exceed the filled amount " + formatRat(cur.filled))
+	}
+	if adm.Decimals != nil {
+		if reason := checkPrecision(o, *adm.Decimals); reason != "" {
+			return reject(reason)
+		}
+	}
+	if adm.Signer != nil {
+		if err := VerifyOrder(o, adm.Signer); err != nil {
+			return reject(err.Error())
+		}
+	}
+	remaining := new(big.Rat).Sub(amount, cur.filled)
+
+	m := b.marketFor(cur.order)
+	if !b.auctionMode() {
+		if best := b.bestMatchable(m.opposite(o.Side)); best != nil && crosses(o.Side, price, best) {
+			return reject("replacement would cross the book")
+		}
+	} else if own, stopped := b.selfCrossing(m, newBookOrder(o, price, remaining)); len(own) > 0 || stopped {
+		return reject("replacement would cross an order of the same trader")
+	}
+	if adm.Balance != nil {
+		// The order's own commitment is available to its replacement.
+		b.releaseFunds(cur, cur.remaining)
+		key, need := commitment(o, price, remaining)
+		reason := b.checkFunds(key, need, adm.Balance)
+		b.lockFunds(cur)
+		if reason != "" {
+			return reject(reason)
+		}
+	}
+
+	b.amend(cur, o, price, remaining)
+	b.publish(message.OrderBookDelta{
+		Updated: []message.Order{cur.row()},
+	})
+	return message.ReplaceOrderAck{
+		ID:        o.ID,
+		Success:   true,
+		Remaining: formatRat(remaining),
+		TotalOpen: b.totalOpen,
+	}
+}
+
+// amend sets the price, amount and signature of the resting order to those of
+// row and its remaining amount to remaining. The order keeps its place in the
+// price level if its price stays and its remaining amount does not grow, and
+// moves to the back of its new level otherwise. Must be called with b.mu
+// held.
+func (b *Book) amend(o *bookOrder, row message.Order, price, remaining *big.Rat) {
+	keep := price.Cmp(o.price) == 0 && remaining.Cmp(o.remaining) <= 0
+	side := b.marketFor(o.order).own(o.order.Side)
+
+	b.releaseFunds(o, o.remaining)
+	if !keep {
+		side.remove(o)
+	}
+	o.order.Price = row.Price
+	o.order.Amount = row.Amount
+	o.order.Nonce = row.Nonce
+	o.order.Signature = row.Signature
+	o.price, o.remaining = price, remaining
+	if !keep {
+		side.insert(o)
+	}
+	b.lockFunds(o)
+}
+
+// sameTerms reports whether the replacement r only differs from the order o
+// in the fields that ReplaceOrder may change.
+func sameTerms(o, r message.Order) bool {
+	sameExpiry := (o.ExpiresAt == nil) == (r.ExpiresAt == nil) &&
+		(o.ExpiresAt == nil || *o.ExpiresAt == *r.ExpiresAt)
+	return r.Base != nil && r.Quote != nil &&
+		o.ChannelID == r.ChannelID &&
+		o.MakerIdx == r.MakerIdx &&
+		o.Side == r.Side &&
+		marketKey(o) == marketKey(r) &&
+		o.Type == r.Type &&
+		o.TimeInForce == r.TimeInForce &&
+		o.PostOnly == r.PostOnly &&
+		o.StopPrice == r.StopPrice &&
+		sameExpiry
+}
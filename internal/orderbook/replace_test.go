@@ -0,0 +1,161 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+// replacement returns the resting order with a new price and amount.
+func replacement(t *testing.T, b *Book, id message.OrderID, price, amount string) message.Order {
+	t.Helper()
+	o, ok := b.Order(id)
+	if !ok {
+		t.Fatalf("order %s not found", id)
+	}
+	o.Price, o.Amount = price, amount
+	return o
+}
+
+func TestReplaceOrder(t *testing.T) {
+	tests := []struct {
+		name          string
+		price, amount string
+		// order lists the asks by their index in the book's priority
+		// order after the replacement.
+		order []int
+		// locked is the base amount committed to the asks.
+		locked string
+	}{
+		{name: "amount down keeps priority", price: "10", amount: "2", order: []int{0, 1, 2}, locked: "4"},
+		{name: "same amount keeps priority", price: "10", amount: "3", order: []int{0, 1, 2}, locked: "5"},
+		{name: "amount up loses priority", price: "10", amount: "4", order: []int{1, 0, 2}, locked: "6"},
+		{name: "price change loses priority", price: "11", amount: "3", order: []int{1, 2, 0}, locked: "5"},
+		{name: "better price", price: "9", amount: "1", order: []int{0, 1, 2}, locked: "3"},
+	}
+
+	chID := channel.ID{1}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(chID)
+			ids := createOrders(t, b, ask(1, "10", "3"), ask(1, "10", "1"), ask(1, "11", "1"))
+			seq := b.Snapshot().Sequence
+
+			ack := b.ReplaceOrder(replacement(t, b, ids[0], tt.price, tt.amount), chID, 1, Admission{})
+			if !ack.Success {
+				t.Fatalf("replace failed: %s", ack.Reason)
+			}
+
+			snap := b.Snapshot()
+			for i, want := range tt.order {
+				if got := snap.Asks[i].ID; got != ids[want] {
+					t.Errorf("ask %d is %s, want order %d", i, got, want)
+				}
+			}
+			if got := locked(b, 1, testBase); got != tt.locked {
+				t.Errorf("locked %s, want %s", got, tt.locked)
+			}
+
+			deltas, _ := b.DeltasSince(seq)
+			if len(deltas) != 1 {
+				t.Fatalf("published %d deltas, want 1", len(deltas))
+			}
+			d := deltas[0]
+			if len(d.Added) != 0 || len(d.Removed) != 0 || len(d.Updated) != 1 {
+				t.Fatalf("delta adds %d, updates %d and removes %d orders, want a single update",
+					len(d.Added), len(d.Updated), len(d.Removed))
+			}
+			if row := d.Updated[0]; row.ID != ids[0] || row.Price != tt.price || row.Remaining != tt.amount {
+				t.Errorf("updated %s to %s@%s, want %s@%s", row.ID, row.Remaining, row.Price, tt.amount, tt.price)
+			}
+		})
+	}
+}
+
+func TestReplaceOrderRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(o *message.Order)
+		maker  channel.Index
+		reason string
+	}{
+		{name: "crossing", change: func(o *message.Order) { o.Price = "9" }, maker: 1, reason: "replacement would cross the book"},
+		{name: "other maker", change: func(o *message.Order) {}, maker: 0, reason: "only the maker can replace the order"},
+		{name: "other side", change: func(o *message.Order) { o.Side = message.SideBid }, maker: 1, reason: "only price and amount can be replaced"},
+		{name: "filled amount", change: func(o *message.Order) { o.Amount = "1" }, maker: 1, reason: "amount must exceed the filled amount 1"},
+		{name: "invalid price", change: func(o *message.Order) { o.Price = "0" }, maker: 1, reason: "invalid price"},
+	}
+
+	chID := channel.ID{1}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(chID)
+			ids := createOrders(t, b, ask(1, "10", "3"), bid(0, "9", "1"))
+			execute(t, b, bid(0, "10", "1"))
+
+			o := replacement(t, b, ids[0], "10", "3")
+			tt.change(&o)
+			if ack := b.ReplaceOrder(o, chID, tt.maker, Admission{}); ack.Success || ack.Reason != tt.reason {
+				t.Errorf("success %t with reason %q, want %q", ack.Success, ack.Reason, tt.reason)
+			}
+			if got := remaining(b, ids[0]); got != "2" {
+				t.Errorf("remaining %q after rejected replacement", got)
+			}
+		})
+	}
+}
+
+func TestReplaceOrderIgnoresReservedLevels(t *testing.T) {
+	chID := channel.ID{1}
+	b := NewEngine().GetOrCreateBook(chID)
+	ids := createOrders(t, b, ask(1, "10", "1"), ask(1, "12", "1"), bid(0, "9", "1"))
+
+	// The best ask is completely reserved by a pending fill.
+	if _, fills := submit(t, b, bid(0, "10", "1")); len(fills) != 1 {
+		t.Fatalf("got %d fills, want 1", len(fills))
+	}
+
+	tests := []struct {
+		price  string
+		reason string
+	}{
+		{price: "10"},
+		{price: "12", reason: "replacement would cross the book"},
+	}
+	for _, tt := range tests {
+		ack := b.ReplaceOrder(replacement(t, b, ids[2], tt.price, "1"), chID, 0, Admission{})
+		if ack.Reason != tt.reason {
+			t.Errorf("bid replaced at %s: reason %q, want %q", tt.price, ack.Reason, tt.reason)
+		}
+	}
+}
+
+func TestReplaceOrderRestore(t *testing.T) {
+	dir := t.TempDir()
+	e, err := OpenEngine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chID := channel.ID{1}
+	b := e.GetOrCreateBook(chID)
+	ids := createOrders(t, b, ask(1, "10", "3"), ask(1, "11", "1"))
+	if ack := b.ReplaceOrder(replacement(t, b, ids[0], "12", "5"), chID, 1, Admission{}); !ack.Success {
+		t.Fatalf("replace failed: %s", ack.Reason)
+	}
+	b.store.close()
+
+	e, err = OpenEngine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	b, _ = e.GetBook(chID)
+	snap := b.Snapshot()
+	if len(snap.Asks) != 2 || snap.Asks[1].ID != ids[0] || snap.Asks[1].Price != "12" || snap.Asks[1].Remaining != "5" {
+		t.Errorf("restored asks %v, want the replaced order last at 12", snap.Asks)
+	}
+	if got := locked(b, 1, testBase); got != "6" {
+		t.Errorf("restored locked funds %s, want 6", got)
+	}
+}
@@ -0,0 +1,49 @@
+package orderbook
+
+import (
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+)
+
+// selfTradeMode returns the self-trade prevention of the order.
+func selfTradeMode(o message.Order) message.SelfTradeMode {
+	if o.SelfTradePrevention == "" {
+		return message.SelfTradeCancelNewest
+	}
+	return o.SelfTradePrevention
+}
+
+// isSelfTrade reports whether both orders are of the same trader. Orders that
+// carry their trader's L2 address are compared by it, so that the orders of a
+// trader in different channels of a consolidated book never match; otherwise
+// by the participant of the channel.
+func isSelfTrade(taker, maker message.Order) bool {
+	if taker.Trader != "" && maker.Trader != "" {
+		return taker.Trader == maker.Trader
+	}
+	return taker.ChannelID == maker.ChannelID && taker.MakerIdx == maker.MakerIdx
+}
+
+// selfCrossing applies the self-trade prevention of the taker to the resting
+// orders of its trader that it crosses in auction mode, where a crossing order
+// would be matched against them once the auction clears. It returns the
+// resting orders to cancel and whether the taker is canceled. Must be called
+// with b.mu held.
+func (b *Book) selfCrossing(m *market, taker *bookOrder) (own []*bookOrder, stopped bool) {
+	mode := selfTradeMode(taker.order)
+	for _, lvl := range m.opposite(taker.order.Side).levels {
+		if !crosses(taker.order.Side, taker.price, lvl.price) {
+			break
+		}
+		for _, o := range lvl.orders {
+			if !isSelfTrade(taker.order, o.order) || b.withdrawn(o) {
+				continue
+			}
+			if mode == message.SelfTradeCancelNewest {
+				return nil, true
+			}
+			own = append(own, o)
+			stopped = mode == message.SelfTradeCancelBoth
+		}
+	}
+	return own, stopped
+}
@@ -0,0 +1,252 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	ethwallet "github.com/perun-network/perun-eth-backend/wallet"
+	"perun.network/go-perun/channel"
+)
+
+func TestSelfTradePrevention(t *testing.T) {
+	withMode := func(o message.Order, mode message.SelfTradeMode) message.Order {
+		o.SelfTradePrevention = mode
+		return o
+	}
+
+	tests := []struct {
+		name    string
+		auction bool
+		// The first resting order is of another maker, the second one of
+		// the taker's maker.
+		resting []message.Order
+		taker   message.Order
+		trades  int
+		// canceled is the dropped amount of the taker, rests its resting
+		// amount.
+		canceled string
+		rests    string
+		// own is the remaining amount of the taker's resting order, "" if
+		// it was canceled.
+		own string
+	}{
+		{
+			name:     "cancel newest by default",
+			resting:  []message.Order{ask(0, "10", "1"), ask(1, "11", "1")},
+			taker:    bid(1, "11", "3"),
+			trades:   1,
+			canceled: "2",
+			own:      "1",
+		},
+		{
+			name:    "cancel oldest",
+			resting: []message.Order{ask(0, "10", "1"), ask(1, "11", "1")},
+			taker:   withMode(bid(1, "11", "3"), message.SelfTradeCancelOldest),
+			trades:  1,
+			rests:   "2",
+		},
+		{
+			name:     "cancel both",
+			resting:  []message.Order{ask(0, "10", "1"), ask(1, "11", "1")},
+			taker:    withMode(bid(1, "11", "3"), message.SelfTradeCancelBoth),
+			trades:   1,
+			canceled: "2",
+		},
+		{
+			name:     "auction cancel newest",
+			auction:  true,
+			resting:  []message.Order{bid(0, "9", "1"), bid(1, "10", "1")},
+			taker:    ask(1, "10", "1"),
+			canceled: "1",
+			own:      "1",
+		},
+		{
+			name:    "auction cancel oldest",
+			auction: true,
+			resting: []message.Order{bid(0, "9", "1"), bid(1, "10", "1")},
+			taker:   withMode(ask(1, "10", "1"), message.SelfTradeCancelOldest),
+			rests:   "1",
+		},
+		{
+			name:     "auction cancel both",
+			auction:  true,
+			resting:  []message.Order{bid(0, "9", "1"), bid(1, "10", "1")},
+			taker:    withMode(ask(1, "10", "1"), message.SelfTradeCancelBoth),
+			canceled: "1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			if tt.auction {
+				b.SetAuctionInterval(60)
+			}
+			ids := createOrders(t, b, tt.resting...)
+			seq := b.Snapshot().Sequence
+
+			ack, trades := execute(t, b, tt.taker)
+			if !ack.Accepted {
+				t.Fatalf("taker rejected: %s", ack.Reason)
+			}
+			if len(trades) != tt.trades {
+				t.Errorf("got %d trades, want %d", len(trades), tt.trades)
+			}
+			if ack.Canceled != tt.canceled || ack.SelfTrade != (tt.canceled != "") {
+				t.Errorf("canceled %q (self-trade %t), want %q", ack.Canceled, ack.SelfTrade, tt.canceled)
+			}
+			if got := remaining(b, ack.ID); got != tt.rests {
+				t.Errorf("taker: remaining %q, want %q", got, tt.rests)
+			}
+
+			own := ids[1]
+			if got := remaining(b, own); got != tt.own {
+				t.Errorf("own order: remaining %q, want %q", got, tt.own)
+			}
+			deltas, _ := b.DeltasSince(seq)
+			var reason message.RemoveReason
+			for _, d := range deltas {
+				if r, ok := d.Reasons[own]; ok {
+					reason = r
+				}
+			}
+			if want := message.RemoveSelfTrade; tt.own == "" && reason != want {
+				t.Errorf("own order removed with reason %q, want %q", reason, want)
+			}
+		})
+	}
+}
+
+func TestSelfTradeAcrossHubChannels(t *testing.T) {
+	e := NewEngine()
+	hub := ethwallet.AsWalletAddr(common.Address{1})
+	trader := ethwallet.AsWalletAddr(common.Address{2})
+	other := ethwallet.AsWalletAddr(common.Address{3})
+	b := e.EnableHub(hub)
+	// The trader has two channels with the hub, the other trader one.
+	chA, chB, chC := channel.ID{2}, channel.ID{3}, channel.ID{4}
+	for _, chID := range []channel.ID{chA, chB, chC} {
+		if !e.RouteChannel(chID, hub) {
+			t.Fatalf("channel %x not routed", chID)
+		}
+	}
+	in := func(o message.Order, chID channel.ID, mode message.SelfTradeMode) message.Order {
+		o.ChannelID, o.SelfTradePrevention = chID, mode
+		return o
+	}
+
+	tests := []struct {
+		name     string
+		taker    message.Order
+		trader   *ethwallet.Address
+		trades   int
+		canceled string
+		rests    string
+		own      string
+	}{
+		{name: "cancel newest", taker: in(bid(0, "10", "1"), chB, ""), trader: trader, canceled: "1", own: "1"},
+		{name: "cancel oldest", taker: in(bid(0, "10", "1"), chB, message.SelfTradeCancelOldest), trader: trader, rests: "1"},
+		{name: "cancel both", taker: in(bid(0, "10", "1"), chB, message.SelfTradeCancelBoth), trader: trader, canceled: "1"},
+		{name: "other trader", taker: in(bid(0, "10", "1"), chC, ""), trader: other, trades: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ack, _ := b.CreateOrder(in(ask(0, "10", "1"), chA, ""), Admission{Trader: trader})
+			if !ack.Accepted {
+				t.Fatalf("resting order rejected: %s", ack.Reason)
+			}
+			own := ack.ID
+			seq := b.Snapshot().Sequence
+
+			// The trader set by the client is ignored.
+			taker := tt.taker
+			taker.Trader = other.String()
+			if tt.trader == other {
+				taker.Trader = trader.String()
+			}
+			ack, fills := b.CreateOrder(taker, Admission{Trader: tt.trader})
+			if !ack.Accepted {
+				t.Fatalf("taker rejected: %s", ack.Reason)
+			}
+			for _, f := range fills {
+				b.CommitFill(f, Settlement{})
+			}
+			if len(fills) != tt.trades {
+				t.Errorf("got %d fills, want %d", len(fills), tt.trades)
+			}
+			if ack.Canceled != tt.canceled || ack.SelfTrade != (tt.canceled != "") {
+				t.Errorf("canceled %q (self-trade %t), want %q", ack.Canceled, ack.SelfTrade, tt.canceled)
+			}
+			if got := remaining(b, ack.ID); got != tt.rests {
+				t.Errorf("taker: remaining %q, want %q", got, tt.rests)
+			}
+			if got := remaining(b, own); got != tt.own {
+				t.Errorf("own order: remaining %q, want %q", got, tt.own)
+			}
+			if tt.trades == 0 && tt.own == "" {
+				deltas, _ := b.DeltasSince(seq)
+				if len(deltas) == 0 || deltas[0].Reasons[own] != message.RemoveSelfTrade {
+					t.Errorf("published %v, want the own order removed as self-trade", deltas)
+				}
+			}
+
+			// Clean up for the next case.
+			for _, id := range []message.OrderID{own, ack.ID} {
+				if o, ok := b.Order(id); ok {
+					b.CancelOrder(id, o.ChannelID, o.MakerIdx)
+				}
+			}
+		})
+	}
+}
+
+func TestAcceptOwnOrderInOtherChannel(t *testing.T) {
+	e := NewEngine()
+	hub := ethwallet.AsWalletAddr(common.Address{1})
+	trader := ethwallet.AsWalletAddr(common.Address{2})
+	b := e.EnableHub(hub)
+	chA, chB := channel.ID{2}, channel.ID{3}
+	e.RouteChannel(chA, hub)
+	e.RouteChannel(chB, hub)
+
+	o := ask(0, "10", "1")
+	o.ChannelID = chA
+	ack, _ := b.CreateOrder(o, Admission{Trader: trader})
+	if !ack.Accepted {
+		t.Fatalf("order rejected: %s", ack.Reason)
+	}
+	if acc, _ := b.AcceptOrder(ack.ID, "", chB, 0, trader); acc.Accepted || acc.Reason != "cannot accept own order" {
+		t.Errorf("accepted %t with reason %q", acc.Accepted, acc.Reason)
+	}
+	if acc, fill := b.AcceptOrder(ack.ID, "", chB, 0, ethwallet.AsWalletAddr(common.Address{3})); !acc.Accepted || fill == nil {
+		t.Errorf("other trader: accepted %t with reason %q", acc.Accepted, acc.Reason)
+	}
+}
+
+func TestAuctionSkipsSelfTrade(t *testing.T) {
+	b := NewEngine().GetOrCreateBook(channel.ID{1})
+	ids := createOrders(t, b, ask(1, "10", "1"))
+
+	// While the ask is reserved, a bid of its maker is not checked against
+	// it and rests crossing it once the fill is aborted.
+	_, fills := submit(t, b, withTIF(bid(0, "10", "1"), message.TimeIOC))
+	if len(fills) != 1 {
+		t.Fatalf("got %d fills, want 1", len(fills))
+	}
+	own := createOrders(t, b, bid(1, "10", "1"))
+	b.AbortFill(fills[0])
+
+	if _, reason := b.SetAuctionInterval(60); reason != "" {
+		t.Fatal(reason)
+	}
+	if fills := clearDue(b); len(fills) != 0 {
+		t.Errorf("auction matched %d fills of the same trader", len(fills))
+	}
+	for _, id := range []message.OrderID{ids[0], own[0]} {
+		if got := remaining(b, id); got != "1" {
+			t.Errorf("order %s: remaining %q, want 1", id, got)
+		}
+	}
+}
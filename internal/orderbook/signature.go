@@ -0,0 +1,28 @@
+package orderbook
+
+import (
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	ethwallet "github.com/perun-network/perun-eth-backend/wallet"
+	"github.com/pkg/errors"
+	"perun.network/go-perun/wallet"
+)
+
+// VerifyOrder checks that the order carries a signature of signer, the
+// maker's L2 address, over the order's SigningData.
+func VerifyOrder(o message.Order, signer wallet.Address) error {
+	if len(o.Signature) == 0 {
+		return errors.New("order is not signed")
+	}
+	data, err := o.SigningData()
+	if err != nil {
+		return err
+	}
+	ok, err := ethwallet.VerifySignature(data, o.Signature, signer)
+	if err != nil {
+		return errors.WithMessage(err, "verifying order signature")
+	}
+	if !ok {
+		return errors.New("invalid order signature")
+	}
+	return nil
+}
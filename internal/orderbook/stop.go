@@ -0,0 +1,144 @@
+package orderbook
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/log"
+)
+
+// stopOrder is a stop or stop-limit order waiting for the last trade price of
+// its market to reach the trigger. Its funds are locked at the limit price,
+// or at the trigger price for stop orders, until it is triggered.
+type stopOrder struct {
+	*bookOrder
+	trigger *big.Rat
+}
+
+// isStop reports whether the order waits for a trigger price.
+func isStop(o message.Order) bool {
+	return o.Type == message.OrderStop || o.Type == message.OrderStopLimit
+}
+
+// stopTriggered reports whether a stop order of the given side triggers at
+// the last trade price.
+func stopTriggered(side message.OrderSide, trigger, last *big.Rat) bool {
+	if side == message.SideBid {
+		return last.Cmp(trigger) >= 0
+	}
+	return last.Cmp(trigger) <= 0
+}
+
+// addStop admits a stop order to the hidden trigger list. It returns the
+// reason for rejecting the order, or "". Must be called with b.mu held.
+func (b *Book) addStop(o message.Order, price, amount, balance *big.Rat) string {
+	trigger, ok := parsePositive(o.StopPrice)
+	if !ok {
+		return "invalid stop price"
+	}
+	if last, ok := b.lastPrice[marketKey(o)]; ok && stopTriggered(o.Side, trigger, last) {
+		return "stop price already reached"
+	}
+
+	lockPrice := price
+	if lockPrice == nil {
+		lockPrice = trigger
+	}
+	if balance != nil {
+		key, need := commitment(o, lockPrice, amount)
+		if reason := b.checkFunds(key, need, balance); reason != "" {
+			return reason
+		}
+	}
+
+	o.Status = message.OrderPending
+	s := &stopOrder{bookOrder: newBookOrder(o, lockPrice, amount), trigger: trigger}
+	b.stops = append(b.stops, s)
+	b.lockFunds(s.bookOrder)
+	b.saveTriggers()
+	return ""
+}
+
+// recordTrade sets the last trade price of the market and releases the stop
+// orders it triggers, in the order they were created. The fills of the
+// released orders are returned for settlement. Must be called with b.mu held.
+func (b *Book) recordTrade(key string, price *big.Rat) []*Fill {
+	b.lastPrice[key] = price
+
+	var fills []*Fill
+	var triggered []*stopOrder
+	kept := b.stops[:0]
+	for _, s := range b.stops {
+		if marketKey(s.order) == key && stopTriggered(s.order.Side, s.trigger, price) {
+			triggered = append(triggered, s)
+		} else {
+			kept = append(kept, s)
+		}
+	}
+	b.stops = kept
+	for _, s := range triggered {
+		fills = append(fills, b.activate(s)...)
+	}
+	b.saveTriggers()
+	return fills
+}
+
+// activate places a triggered stop order in the live book. An order that
+// expired in the meantime or cannot be executed as requested is dropped. Must
+// be called with b.mu held.
+func (b *Book) activate(s *stopOrder) []*Fill {
+	b.releaseFunds(s.bookOrder, s.remaining)
+
+	o := s.order
+	if isExpired(o, time.Now().Unix()) {
+		return nil
+	}
+	o.Status = message.OrderOpen
+	var price *big.Rat
+	if !isMarket(o) {
+		price = s.price
+	}
+	fills, _, _, reason := b.place(b.marketFor(o), o, price, s.remaining)
+	if reason != "" {
+		log.Infof("order book %x: dropping triggered stop order %s: %s", b.chID, o.ID, reason)
+	}
+	return fills
+}
+
+// removeStop takes the stop order with the given ID out of the trigger list
+// and releases its funds. Must be called with b.mu held.
+func (b *Book) removeStop(id message.OrderID) {
+	for i, s := range b.stops {
+		if s.order.ID == id {
+			b.stops = append(b.stops[:i], b.stops[i+1:]...)
+			b.releaseFunds(s.bookOrder, s.remaining)
+			b.saveTriggers()
+			return
+		}
+	}
+}
+
+// findStop returns the waiting stop order with the given ID.
+func (b *Book) findStop(id message.OrderID) (*stopOrder, bool) {
+	for _, s := range b.stops {
+		if s.order.ID == id {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// expireStops drops waiting stop orders past their expiry. They were never
+// visible, so no delta is published. Must be called with b.mu held.
+func (b *Book) expireStops(now int64) {
+	var expired []message.OrderID
+	for _, s := range b.stops {
+		if isExpired(s.order, now) {
+			expired = append(expired, s.order.ID)
+		}
+	}
+	for _, id := range expired {
+		b.removeStop(id)
+	}
+}
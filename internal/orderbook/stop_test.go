@@ -0,0 +1,160 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"perun.network/go-perun/channel"
+)
+
+func TestStopTrigger(t *testing.T) {
+	stop := func(o message.Order, trigger string) message.Order {
+		o.Type, o.Price, o.StopPrice = message.OrderStop, "", trigger
+		return o
+	}
+	stopLimit := func(o message.Order, trigger string) message.Order {
+		o.Type, o.StopPrice = message.OrderStopLimit, trigger
+		return o
+	}
+
+	tests := []struct {
+		name      string
+		liquidity []message.Order
+		stop      message.Order
+		// last is the price of the trade that follows the stop order.
+		last   string
+		reason string
+		// fills are the trades of the triggered order, rests its resting
+		// amount.
+		triggered bool
+		fills     int
+		rests     string
+	}{
+		{
+			name:      "sell stop at the trigger",
+			liquidity: []message.Order{bid(1, "8", "5")},
+			stop:      stop(ask(0, "", "1"), "9"),
+			last:      "9",
+			triggered: true,
+			fills:     1,
+		},
+		{
+			name:      "sell stop below the trigger",
+			liquidity: []message.Order{bid(1, "8", "5")},
+			stop:      stop(ask(0, "", "1"), "9"),
+			last:      "8.5",
+			triggered: true,
+			fills:     1,
+		},
+		{
+			name:      "sell stop above the trigger",
+			liquidity: []message.Order{bid(1, "8", "5")},
+			stop:      stop(ask(0, "", "1"), "9"),
+			last:      "9.5",
+		},
+		{
+			name:      "buy stop",
+			liquidity: []message.Order{ask(1, "12", "5")},
+			stop:      stop(bid(0, "", "1"), "11"),
+			last:      "11",
+			triggered: true,
+			fills:     1,
+		},
+		{
+			name:      "buy stop below the trigger",
+			liquidity: []message.Order{ask(1, "12", "5")},
+			stop:      stop(bid(0, "", "1"), "11"),
+			last:      "10",
+		},
+		{
+			name:      "stop-limit rests",
+			liquidity: []message.Order{bid(1, "8", "5")},
+			stop:      stopLimit(ask(0, "9.5", "2"), "9"),
+			last:      "9",
+			triggered: true,
+			rests:     "2",
+		},
+		{
+			name:      "stop-limit trades up to its limit",
+			liquidity: []message.Order{bid(1, "8", "1")},
+			stop:      stopLimit(ask(0, "8", "2"), "9"),
+			last:      "9",
+			triggered: true,
+			fills:     1,
+			rests:     "1",
+		},
+		{
+			name:   "missing trigger",
+			stop:   stop(ask(0, "", "1"), ""),
+			reason: "invalid stop price",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			createOrders(t, b, tt.liquidity...)
+
+			// Waiting stop orders are hidden.
+			seq := b.Snapshot().Sequence
+			ack, fills := submit(t, b, tt.stop)
+			if ack.Reason != tt.reason || ack.Accepted != (tt.reason == "") {
+				t.Fatalf("accepted %t with reason %q, want %q", ack.Accepted, ack.Reason, tt.reason)
+			}
+			if !ack.Accepted {
+				return
+			}
+			if len(fills) > 0 || b.Snapshot().Sequence != seq || remaining(b, ack.ID) != "" {
+				t.Fatal("waiting stop order is visible")
+			}
+
+			createOrders(t, b, ask(1, tt.last, "1"))
+			_, trades := execute(t, b, bid(0, tt.last, "1"))
+			if len(trades) == 0 || trades[0].Price != tt.last {
+				t.Fatalf("no trade at %s", tt.last)
+			}
+
+			b.mu.Lock()
+			_, waiting := b.findStop(ack.ID)
+			b.mu.Unlock()
+			if waiting == tt.triggered {
+				t.Errorf("waiting %t, want %t", waiting, !tt.triggered)
+			}
+			if n := len(trades) - 1; n != tt.fills {
+				t.Errorf("triggered order made %d trades, want %d", n, tt.fills)
+			}
+			for _, tr := range trades[1:] {
+				if tr.TakerOrderID != ack.ID {
+					t.Errorf("trade of %s, want the stop order %s", tr.TakerOrderID, ack.ID)
+				}
+			}
+			if got := remaining(b, ack.ID); got != tt.rests {
+				t.Errorf("remaining %q, want %q", got, tt.rests)
+			}
+		})
+	}
+}
+
+func TestStopPriceAlreadyReached(t *testing.T) {
+	b := NewEngine().GetOrCreateBook(channel.ID{1})
+	createOrders(t, b, ask(1, "9", "1"))
+	execute(t, b, bid(0, "9", "1"))
+
+	tests := []struct {
+		side    message.OrderSide
+		trigger string
+		reason  string
+	}{
+		{side: message.SideAsk, trigger: "10", reason: "stop price already reached"},
+		{side: message.SideAsk, trigger: "8"},
+		{side: message.SideBid, trigger: "8", reason: "stop price already reached"},
+		{side: message.SideBid, trigger: "10"},
+	}
+	for _, tt := range tests {
+		o := testOrder(tt.side, 0, "", "1")
+		o.Type, o.StopPrice = message.OrderStop, tt.trigger
+		if ack, _ := submit(t, b, o); ack.Reason != tt.reason {
+			t.Errorf("%s stop at %s: reason %q, want %q", tt.side, tt.trigger, ack.Reason, tt.reason)
+		}
+	}
+}
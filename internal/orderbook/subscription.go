@@ -0,0 +1,163 @@
+package orderbook
+
+import (
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+)
+
+// SubscriberQueueSize is the number of deltas queued for a subscriber before
+// it is considered too slow and has to resynchronize.
+const SubscriberQueueSize = 256
+
+// Subscription receives the deltas or the trades of a book in sequence order
+// through a bounded queue. If the queue overflows, the subscription stops
+// queueing and signals Lost until the subscriber calls Resync or
+// ResyncTrades.
+type Subscription struct {
+	book   *Book
+	deltas chan message.OrderBookDelta
+	trades chan message.Trade
+	lost   chan struct{}
+
+	// The following fields are guarded by book.mu.
+	lastSeq uint64
+	stale   bool
+}
+
+// Deltas returns the queue of deltas, which is nil for trade subscriptions.
+func (s *Subscription) Deltas() <-chan message.OrderBookDelta {
+	return s.deltas
+}
+
+// Trades returns the queue of trades, which is nil for delta subscriptions.
+func (s *Subscription) Trades() <-chan message.Trade {
+	return s.trades
+}
+
+// Lost is signaled once deltas or trades were dropped because the queue was
+// full.
+func (s *Subscription) Lost() <-chan struct{} {
+	return s.lost
+}
+
+// Resync empties the queue and resumes queueing deltas. It returns the frame
+// that tells the subscriber it fell behind and a snapshot that the queued
+// deltas continue from.
+func (s *Subscription) Resync() (message.ResyncRequired, message.OrderBookSnapshot) {
+	b := s.book
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(s.deltas) > 0 {
+		<-s.deltas
+	}
+	select {
+	case <-s.lost:
+	default:
+	}
+	resync := message.ResyncRequired{ChannelID: b.chID, Sequence: s.lastSeq}
+	s.stale = false
+	s.lastSeq = b.sequence
+	return resync, b.snapshot()
+}
+
+// ResyncTrades empties the queue of a trade subscription and resumes queueing
+// trades. It returns the frame that tells the subscriber which trade it
+// received last; the missed ones can be queried from the trade log.
+func (s *Subscription) ResyncTrades() message.ResyncRequired {
+	b := s.book
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(s.trades) > 0 {
+		<-s.trades
+	}
+	select {
+	case <-s.lost:
+	default:
+	}
+	resync := message.ResyncRequired{ChannelID: b.chID, Sequence: s.lastSeq}
+	s.stale = false
+	s.lastSeq = b.lastTradeSeq()
+	return resync
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.book.mu.Lock()
+	defer s.book.mu.Unlock()
+	delete(s.book.subscribers, s)
+}
+
+// Subscribe returns a subscription to all deltas published from now on.
+func (b *Book) Subscribe() *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.subscribe()
+}
+
+// subscribe is Subscribe with b.mu held.
+func (b *Book) subscribe() *Subscription {
+	s := &Subscription{
+		book:    b,
+		deltas:  make(chan message.OrderBookDelta, SubscriberQueueSize),
+		lost:    make(chan struct{}, 1),
+		lastSeq: b.sequence,
+	}
+	b.subscribers[s] = struct{}{}
+	return s
+}
+
+// SubscribeTrades returns a subscription to all trades settled from now on.
+func (b *Book) SubscribeTrades() *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &Subscription{
+		book:    b,
+		trades:  make(chan message.Trade, SubscriberQueueSize),
+		lost:    make(chan struct{}, 1),
+		lastSeq: b.lastTradeSeq(),
+	}
+	b.subscribers[s] = struct{}{}
+	return s
+}
+
+// broadcast queues the delta for every subscriber. Subscribers whose queue is
+// full miss this and all later deltas until they resynchronize. As it is
+// called with b.mu held, every subscriber receives deltas in sequence order.
+func (b *Book) broadcast(delta message.OrderBookDelta) {
+	for s := range b.subscribers {
+		if s.deltas == nil || s.stale {
+			continue
+		}
+		select {
+		case s.deltas <- delta:
+			s.lastSeq = delta.Sequence
+		default:
+			s.markLost()
+		}
+	}
+}
+
+// broadcastTrade queues the trade for every trade subscriber like broadcast.
+// Must be called with b.mu held.
+func (b *Book) broadcastTrade(t message.Trade) {
+	for s := range b.subscribers {
+		if s.trades == nil || s.stale {
+			continue
+		}
+		select {
+		case s.trades <- t:
+			s.lastSeq = t.Sequence
+		default:
+			s.markLost()
+		}
+	}
+}
+
+// markLost stops queueing for the subscriber and signals Lost. Must be called
+// with book.mu held.
+func (s *Subscription) markLost() {
+	s.stale = true
+	s.lost <- struct{}{}
+}
@@ -0,0 +1,78 @@
+package orderbook
+
+import (
+	"testing"
+
+	"perun.network/go-perun/channel"
+)
+
+func TestSlowSubscriberResync(t *testing.T) {
+	tests := []struct {
+		name      string
+		published int
+		lost      bool
+	}{
+		{name: "queue not full", published: SubscriberQueueSize},
+		{name: "one delta too many", published: SubscriberQueueSize + 1, lost: true},
+		{name: "far behind", published: 2 * SubscriberQueueSize, lost: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewEngine().GetOrCreateBook(channel.ID{1})
+			seq := b.Snapshot().Sequence
+			slow, fast := b.Subscribe(), b.Subscribe()
+			defer slow.Close()
+			defer fast.Close()
+
+			// The fast subscriber keeps up and is not affected by the
+			// slow one.
+			for i := 0; i < tt.published; i++ {
+				createOrders(t, b, ask(1, "10", "1"))
+				if d := <-fast.Deltas(); d.Sequence != seq+uint64(i)+1 {
+					t.Fatalf("fast subscriber got sequence %d, want %d", d.Sequence, seq+uint64(i)+1)
+				}
+			}
+			select {
+			case <-fast.Lost():
+				t.Fatal("fast subscriber lost deltas")
+			default:
+			}
+
+			select {
+			case <-slow.Lost():
+				if !tt.lost {
+					t.Fatal("lost signaled without overflow")
+				}
+			default:
+				if tt.lost {
+					t.Fatal("overflow not signaled")
+				}
+				// Without overflow all deltas are queued in order.
+				for i := 0; i < tt.published; i++ {
+					if d := <-slow.Deltas(); d.Sequence != seq+uint64(i)+1 {
+						t.Fatalf("got sequence %d, want %d", d.Sequence, seq+uint64(i)+1)
+					}
+				}
+				return
+			}
+
+			resync, snap := slow.Resync()
+			if want := seq + SubscriberQueueSize; resync.Sequence != want {
+				t.Errorf("resync after sequence %d, want %d", resync.Sequence, want)
+			}
+			if want := seq + uint64(tt.published); snap.Sequence != want || len(snap.Asks) != tt.published {
+				t.Errorf("snapshot at %d with %d asks, want %d with %d", snap.Sequence, len(snap.Asks), want, tt.published)
+			}
+			if len(slow.Deltas()) != 0 {
+				t.Error("queue not emptied")
+			}
+
+			// Queueing resumes after the snapshot.
+			createOrders(t, b, ask(1, "10", "1"))
+			if d := <-slow.Deltas(); d.Sequence != snap.Sequence+1 {
+				t.Errorf("got sequence %d after resync, want %d", d.Sequence, snap.Sequence+1)
+			}
+		})
+	}
+}
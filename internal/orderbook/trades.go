@@ -0,0 +1,295 @@
+package orderbook
+
+import (
+	"bufio"
+	"encoding/json"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"github.com/pkg/errors"
+	"perun.network/go-perun/channel"
+	"perun.network/go-perun/log"
+)
+
+const (
+	// DefaultTradeLimit is the number of trades returned per page if the
+	// request does not set a limit.
+	DefaultTradeLimit = 100
+	// MaxTradeLimit bounds the number of trades returned per page.
+	MaxTradeLimit = 1000
+	// DefaultCandleLimit is the number of candles returned if the request
+	// does not set a limit.
+	DefaultCandleLimit = 500
+	// MaxCandleLimit bounds the number of candles returned per request.
+	MaxCandleLimit = 5000
+	// TradeWindow is the number of most recent trades a book keeps in
+	// memory. Older trades are read from the trade log when queried; books
+	// that are not persisted drop them.
+	TradeWindow = 10000
+)
+
+// TradeQuery selects a page of the trade log. Zero values leave the
+// respective bound open.
+type TradeQuery struct {
+	Market        string
+	From, To      int64
+	AfterSequence uint64
+	Limit         int
+}
+
+// logTrade assigns the next trade sequence to the trade, appends it to the
+// trade log and queues it for the trade subscribers. Must be called with b.mu
+// held.
+func (b *Book) logTrade(t *message.Trade) {
+	t.Sequence = b.lastTradeSeq() + 1
+	b.trades = trimTrades(append(b.trades, *t))
+	b.broadcastTrade(*t)
+	if b.store == nil {
+		return
+	}
+	if err := b.store.appendTrade(*t); err != nil {
+		log.Errorf("order book %x: appending to trade log: %v", b.chID, err)
+	}
+}
+
+// lastTradeSeq returns the sequence of the last trade, or 0. Must be called
+// with b.mu held.
+func (b *Book) lastTradeSeq() uint64 {
+	if n := len(b.trades); n > 0 {
+		return b.trades[n-1].Sequence
+	}
+	return 0
+}
+
+// trimTrades drops all but the last TradeWindow trades once there are twice
+// as many. The trades are copied to a new slice, so that a slice taken from
+// the book before stays valid.
+func trimTrades(trades []message.Trade) []message.Trade {
+	if len(trades) < 2*TradeWindow {
+		return trades
+	}
+	return append(make([]message.Trade, 0, 2*TradeWindow), trades[len(trades)-TradeWindow:]...)
+}
+
+// tradeHistory is a view of a book's trades that is read without holding the
+// book's lock, so that queries do not block matching.
+type tradeHistory struct {
+	// window are the trades in memory, oldest first.
+	window []message.Trade
+	// log is the path of the trade log, empty if the book is not persisted.
+	log  string
+	book channel.ID
+}
+
+// history returns the current trades of the book. Must be called with b.mu
+// held.
+func (b *Book) history() tradeHistory {
+	return tradeHistory{window: b.trades, log: b.tradeLog, book: b.chID}
+}
+
+// each calls fn with every trade after sequence after, oldest first, until fn
+// returns false. Trades older than the window are read from the trade log
+// unless the window covers the query: it starts right after after, or from is
+// set and the window's first trade is older than from.
+func (h tradeHistory) each(after uint64, from int64, fn func(message.Trade) bool) {
+	covered := len(h.window) > 0 &&
+		(h.window[0].Sequence <= after+1 || (from != 0 && h.window[0].Timestamp < from))
+	if h.log != "" && !covered {
+		done, err := h.eachLogged(after, fn)
+		if err != nil {
+			log.Errorf("order book %x: reading trade log: %v", h.book, err)
+		}
+		if done {
+			return
+		}
+	}
+
+	i := sort.Search(len(h.window), func(i int) bool {
+		return h.window[i].Sequence > after
+	})
+	for ; i < len(h.window); i++ {
+		if !fn(h.window[i]) {
+			return
+		}
+	}
+}
+
+// eachLogged calls fn with the trades of the trade log after sequence after
+// that precede the window. It reports whether fn ended the iteration.
+func (h tradeHistory) eachLogged(after uint64, fn func(message.Trade) bool) (bool, error) {
+	f, err := os.Open(h.log)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var t message.Trade
+		// A line that is being written is not complete yet.
+		if err := json.Unmarshal(sc.Bytes(), &t); err != nil {
+			break
+		}
+		if len(h.window) > 0 && t.Sequence >= h.window[0].Sequence {
+			break
+		}
+		if t.Sequence <= after {
+			continue
+		}
+		if !fn(t) {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
+
+// Trades returns the trades matching the query, oldest first, and whether
+// more trades follow the returned page.
+func (b *Book) Trades(q TradeQuery) ([]message.Trade, bool) {
+	b.mu.Lock()
+	h := b.history()
+	b.mu.Unlock()
+
+	limit := pageLimit(q.Limit, DefaultTradeLimit, MaxTradeLimit)
+	trades := []message.Trade{}
+	more := false
+	h.each(q.AfterSequence, q.From, func(t message.Trade) bool {
+		if !q.matches(t) {
+			return true
+		}
+		if len(trades) == limit {
+			more = true
+			return false
+		}
+		trades = append(trades, t)
+		return true
+	})
+	return trades, more
+}
+
+func (q TradeQuery) matches(t message.Trade) bool {
+	return (q.Market == "" || t.Market == q.Market) &&
+		(q.From == 0 || t.Timestamp >= q.From) &&
+		(q.To == 0 || t.Timestamp < q.To)
+}
+
+// Candles aggregates the trades of market into candles of interval seconds
+// whose start lies in [from, to), oldest first. Candles start at multiples of
+// the interval since the unix epoch, and intervals without trades are left
+// out.
+func (b *Book) Candles(market string, interval, from, to int64, limit int) ([]message.Candle, error) {
+	if market == "" {
+		return nil, errors.New("missing market")
+	}
+	if interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+	limit = pageLimit(limit, DefaultCandleLimit, MaxCandleLimit)
+
+	b.mu.Lock()
+	h := b.history()
+	b.mu.Unlock()
+
+	var (
+		candles []message.Candle
+		cur     *candle
+	)
+	h.each(0, from, func(t message.Trade) bool {
+		if t.Market != market || t.Unbalanced {
+			return true
+		}
+		start := t.Timestamp - t.Timestamp%interval
+		if t.Timestamp < 0 && t.Timestamp%interval != 0 {
+			start -= interval
+		}
+		if (from != 0 && start < from) || (to != 0 && start >= to) {
+			return true
+		}
+		price, ok := new(big.Rat).SetString(t.Price)
+		if !ok {
+			return true
+		}
+		amount, ok := new(big.Rat).SetString(t.Amount)
+		if !ok {
+			return true
+		}
+		if cur == nil || cur.start != start {
+			if cur != nil {
+				candles = append(candles, cur.candle())
+				if len(candles) == limit {
+					cur = nil
+					return false
+				}
+			}
+			cur = newCandle(start, price)
+		}
+		cur.add(price, amount)
+		return true
+	})
+	if cur != nil {
+		candles = append(candles, cur.candle())
+	}
+	if candles == nil {
+		candles = []message.Candle{}
+	}
+	return candles, nil
+}
+
+// candle is a candle under construction.
+type candle struct {
+	start                  int64
+	open, high, low, close *big.Rat
+	volume, quoteVolume    *big.Rat
+	trades                 int
+}
+
+func newCandle(start int64, open *big.Rat) *candle {
+	return &candle{
+		start:       start,
+		open:        open,
+		high:        open,
+		low:         open,
+		close:       open,
+		volume:      new(big.Rat),
+		quoteVolume: new(big.Rat),
+	}
+}
+
+func (c *candle) add(price, amount *big.Rat) {
+	if price.Cmp(c.high) > 0 {
+		c.high = price
+	}
+	if price.Cmp(c.low) < 0 {
+		c.low = price
+	}
+	c.close = price
+	c.volume.Add(c.volume, amount)
+	c.quoteVolume.Add(c.quoteVolume, new(big.Rat).Mul(price, amount))
+	c.trades++
+}
+
+func (c *candle) candle() message.Candle {
+	return message.Candle{
+		Start:       c.start,
+		Open:        formatRat(c.open),
+		High:        formatRat(c.high),
+		Low:         formatRat(c.low),
+		Close:       formatRat(c.close),
+		Volume:      formatRat(c.volume),
+		QuoteVolume: formatRat(c.quoteVolume),
+		Trades:      c.trades,
+	}
+}
+
+// pageLimit returns n bounded by max, or def if n is not positive.
+func pageLimit(n, def, max int) int {
+	if n <= 0 {
+		return def
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
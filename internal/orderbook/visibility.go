@@ -0,0 +1,21 @@
+package orderbook
+
+// Public reports whether the book may be streamed by clients that are not
+// participants of its channel.
+func (b *Book) Public() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.settings.Public
+}
+
+// SetPublic marks the book as public or private. The setting is persisted with
+// the book.
+func (b *Book) SetPublic(public bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.settings.Public == public {
+		return
+	}
+	b.settings.Public = public
+	b.saveSettings()
+}
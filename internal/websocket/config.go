@@ -16,6 +16,7 @@ import (
 
 	"github.com/perun-network/perun-dex-websocket/internal/client"
 	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"github.com/perun-network/perun-dex-websocket/internal/orderbook"
 
 	"github.com/pkg/errors"
 )
@@ -48,7 +49,10 @@ type (
 		WSAddress      string
 		TLSCertificate string
 		TLSPrivKey     string
-		ClientConfig   client.Config
+		// OrderBookDir is the directory the order books are persisted in. The
+		// books are kept in memory only if it is empty.
+		OrderBookDir string
+		ClientConfig client.Config
 	}
 
 	// EthereumChainsConfig represents the parsed chains' config file.
@@ -70,6 +74,29 @@ type (
 		Adjudicator common.Address                `json:"adjudicator"`
 		Assets      []message.EthereumAssetConfig `json:"assets"`
 	}
+	// FeesConfig represents the parsed fee schedule file. Markets and assets
+	// are listed rather than keyed, as their keys are case-sensitive.
+	FeesConfig struct {
+		Markets []MarketFeeConfig `json:"markets"`
+		Assets  []AssetFeeConfig  `json:"assets"`
+	}
+
+	// MarketFeeConfig sets the fees in basis points of a market, named
+	// "<assetType>:<code>/<assetType>:<code>" of base and quote.
+	MarketFeeConfig struct {
+		Market string `json:"market"`
+		Maker  uint32 `json:"maker"`
+		Taker  uint32 `json:"taker"`
+	}
+
+	// AssetFeeConfig sets the fees in basis points of the parties that
+	// receive an asset, named "<assetType>:<code>".
+	AssetFeeConfig struct {
+		Asset string `json:"asset"`
+		Maker uint32 `json:"maker"`
+		Taker uint32 `json:"taker"`
+	}
+
 	// SolanaChainConfig represents the configuration of a Solana chain.
 	SolanaChainConfig struct {
 		Name         string                      `json:"name"`
@@ -149,6 +176,37 @@ func ParseSolanaChainsConfig(file string) (SolanaChainsConfig, error) {
 	return chainsFile, nil
 }
 
+// ParseFeesConfig reads the fee schedule file and returns the schedule.
+func ParseFeesConfig(file string) (orderbook.FeeSchedule, error) {
+	var feesFile FeesConfig
+
+	viper.SetConfigFile(file)
+	if err := viper.ReadInConfig(); err != nil {
+		return orderbook.FeeSchedule{}, err
+	}
+	if err := viper.Unmarshal(&feesFile); err != nil {
+		return orderbook.FeeSchedule{}, err
+	}
+
+	fees := orderbook.FeeSchedule{
+		Markets: make(map[string]orderbook.FeeRates),
+		Assets:  make(map[string]orderbook.FeeRates),
+	}
+	for _, m := range feesFile.Markets {
+		if _, ok := fees.Markets[m.Market]; ok {
+			return orderbook.FeeSchedule{}, errors.Errorf("duplicate market %v", m.Market)
+		}
+		fees.Markets[m.Market] = orderbook.FeeRates{Maker: m.Maker, Taker: m.Taker}
+	}
+	for _, a := range feesFile.Assets {
+		if _, ok := fees.Assets[a.Asset]; ok {
+			return orderbook.FeeSchedule{}, errors.Errorf("duplicate asset %v", a.Asset)
+		}
+		fees.Assets[a.Asset] = orderbook.FeeRates{Maker: a.Maker, Taker: a.Taker}
+	}
+	return fees, fees.Validate()
+}
+
 // ChainMap returns the chains as a map where the chain's ID is the key.
 func (c EthereumChainsConfig) ChainMap() client.EthereumChainMap {
 	chains := make(client.EthereumChainMap)
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/perun-network/perun-dex-websocket/internal/client"
+	"github.com/perun-network/perun-dex-websocket/internal/orderbook"
 	"github.com/sirupsen/logrus"
 	"perun.network/go-perun/log"
 	plogrus "perun.network/go-perun/log/logrus"
@@ -17,6 +18,20 @@ var upgrader = websocket.Upgrader{
 
 // Run runs the node by handling requests to /connect.
 func Run(config Config) {
+	if config.OrderBookDir != "" {
+		engine, err := orderbook.OpenEngine(config.OrderBookDir)
+		if err != nil {
+			log.Fatalf("opening order book: %v", err)
+		}
+		client.OrderBookEngine = engine
+		go engine.RunSnapshots(orderbook.SnapshotInterval)
+	}
+	if config.ClientConfig.ChannelDir != "" {
+		if err := clients.RestoreChannels(config.ClientConfig); err != nil {
+			log.Fatalf("restoring channels: %v", err)
+		}
+	}
+
 	http.Handle("/", http.FileServer(http.Dir("./web")))
 
 	http.HandleFunc("/connect", func(w http.ResponseWriter, r *http.Request) {
@@ -27,6 +42,9 @@ func Run(config Config) {
 	// Add order book streaming endpoint
 	http.HandleFunc("/ws/orderbook", ServeOrderBookStream)
 
+	go client.OrderBookEngine.RunExpiry(orderbook.ExpiryInterval)
+	go client.OrderBookEngine.RunAuctions(orderbook.AuctionTick, clients.SettleAuction)
+
 	if config.TLSCertificate != "" && config.TLSPrivKey != "" {
 		log.Fatal(http.ListenAndServeTLS(config.WSAddress, config.TLSCertificate, config.TLSPrivKey, nil))
 	} else {
@@ -3,27 +3,84 @@ package websocket
 import (
 	"encoding/hex"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/perun-network/perun-dex-websocket/internal/client"
 	"github.com/perun-network/perun-dex-websocket/internal/message"
+	"github.com/perun-network/perun-dex-websocket/internal/orderbook"
 	"perun.network/go-perun/channel"
 	"perun.network/go-perun/log"
 )
 
+const (
+	// streamWriteTimeout bounds writing a single frame to a subscriber.
+	streamWriteTimeout = 10 * time.Second
+	// streamPingInterval is the interval in which idle streams are pinged.
+	streamPingInterval = 30 * time.Second
+	// muxQueueSize is the number of frames the multiplexed stream buffers
+	// for the socket across all its subscriptions.
+	muxQueueSize = 256
+)
+
+// streamUpgrader does not check origins, as streams are authenticated with a
+// token in the URL rather than with ambient credentials like cookies.
 var streamUpgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-// ServeOrderBookStream handles /ws/orderbook?channel=<hex> for streaming.
+// ServeOrderBookStream handles
+// /ws/orderbook?token=<token>&channel=<hex>[&since=<seq>] for streaming. The
+// token is issued to a client over /connect with GetStreamToken, and the
+// client may only stream the books of its channels and public books. Streams
+// end when the client disconnects. With since, a reconnecting subscriber first
+// receives the deltas it missed, or a snapshot if they are no longer
+// available. Deltas are sent in sequence order; a subscriber that falls too
+// far behind receives a ResyncRequired frame followed by a fresh snapshot.
+//
+// With depth=<n>[&market=<pair>] the stream is in depth mode instead: it sends
+// an OrderBookDepth of the top n price levels per side followed by
+// OrderBookDepthDelta frames with the levels that changed.
+//
+// Without channel the stream is multiplexed: the subscriber sends Subscribe
+// and Unsubscribe messages for any number of channels and topics and receives
+// every frame wrapped in a StreamFrame tagged with its channel and topic.
 func ServeOrderBookStream(w http.ResponseWriter, r *http.Request) {
+	c, ok := clients.Authenticate(r.URL.Query().Get("token"))
+	if !ok {
+		http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+		return
+	}
+
 	chHex := r.URL.Query().Get("channel")
 	if chHex == "" {
-		http.Error(w, "missing channel parameter", http.StatusBadRequest)
+		serveMuxStream(w, r, c)
 		return
 	}
 
+	var since uint64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid since parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	depthMode := r.URL.Query().Has("depth")
+	var levels int
+	if d := r.URL.Query().Get("depth"); d != "" {
+		var err error
+		levels, err = strconv.Atoi(d)
+		if err != nil || levels < 0 {
+			http.Error(w, "invalid depth parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
 	var chID channel.ID
 	bs, err := hex.DecodeString(chHex)
 	if err != nil || len(bs) != len(chID) {
@@ -31,6 +88,10 @@ func ServeOrderBookStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	copy(chID[:], bs)
+	if !c.CanStream(chID) {
+		http.Error(w, "not authorized for channel", http.StatusForbidden)
+		return
+	}
 
 	conn, err := streamUpgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -39,36 +100,321 @@ func ServeOrderBookStream(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	book := client.OrderBookEngine.GetOrCreateBook(chID)
+	stop := make(chan struct{})
+	defer close(stop)
+	go keepAlive(conn, stop)
 
-	// Send initial snapshot
-	snap := book.Snapshot()
-	snapFrame := message.JSONObject{Message: &snap}
-	if err := conn.WriteJSON(snapFrame); err != nil {
+	send := func(msg message.Message) bool {
+		return writeFrame(conn, msg) == nil
+	}
+	book := client.OrderBookEngine.GetOrCreateBook(chID)
+	if depthMode {
+		streamDepth(book, levels, r.URL.Query().Get("market"), send, c.Done())
 		return
 	}
+	streamBook(book, since, send, c.Done())
+}
 
-	// Subscribe to deltas
-	deltaCh := make(chan []byte, 64)
-	book.Subscribe(deltaCh)
-	defer book.Unsubscribe(deltaCh)
+// writeFrame writes a single typed frame to the stream.
+func writeFrame(conn *websocket.Conn, msg message.Message) error {
+	conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return conn.WriteJSON(&message.JSONObject{Message: msg})
+}
 
-	// Send deltas
-	ticker := time.NewTicker(30 * time.Second)
+// keepAlive pings the stream until stop is closed. Pings are control frames
+// and may be written concurrently with the data frames.
+func keepAlive(conn *websocket.Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(streamPingInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case data := <-deltaCh:
-			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
 				return
 			}
-		case <-ticker.C:
-			// Send ping to keep connection alive
-			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sendFunc delivers a frame of one subscription. It returns false once the
+// subscription should end.
+type sendFunc func(message.Message) bool
+
+// streamBook sends the book's snapshot, or the deltas missed after since, and
+// then its live deltas until send fails or done is closed.
+func streamBook(book *orderbook.Book, since uint64, send sendFunc, done <-chan struct{}) {
+	// Subscribe to deltas and catch up from the journal or a snapshot.
+	sub, snap, missed := book.SubscribeSince(since)
+	defer sub.Close()
+
+	if snap != nil && !send(snap) {
+		return
+	}
+	for i := range missed {
+		if !send(&missed[i]) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case delta := <-sub.Deltas():
+			if !send(&delta) {
+				return
+			}
+		case <-sub.Lost():
+			// The subscriber fell behind; it starts over from a snapshot.
+			resync, snap := sub.Resync()
+			if !send(&resync) || !send(&snap) {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// streamDepth streams the aggregated depth of the book. Every delta of the
+// book triggers a new depth view that is sent as the levels that changed
+// compared to the previous one.
+func streamDepth(book *orderbook.Book, levels int, market string, send sendFunc, done <-chan struct{}) {
+	sub := book.Subscribe()
+	defer sub.Close()
+
+	depth := book.Depth(levels, market)
+	if !send(&depth) {
+		return
+	}
+
+	for {
+		select {
+		case <-sub.Lost():
+			// The subscriber fell behind; it starts over from a full view.
+			resync, _ := sub.Resync()
+			depth = book.Depth(levels, market)
+			if !send(&resync) || !send(&depth) {
+				return
+			}
+		case <-sub.Deltas():
+			next := book.Depth(levels, market)
+			delta, changed := orderbook.DiffDepth(depth, next)
+			depth = next
+			if changed && !send(&delta) {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// streamTrades sends the book's trades as they are settled. A subscriber that
+// falls behind receives a ResyncRequired frame with the last trade it got and
+// can fetch the missed ones with GetTrades.
+func streamTrades(book *orderbook.Book, send sendFunc, done <-chan struct{}) {
+	sub := book.SubscribeTrades()
+	defer sub.Close()
+
+	for {
+		select {
+		case trade := <-sub.Trades():
+			if !send(&trade) {
+				return
+			}
+		case <-sub.Lost():
+			resync := sub.ResyncTrades()
+			if !send(&resync) {
 				return
 			}
+		case <-done:
+			return
 		}
 	}
 }
+
+// streamKey identifies a subscription of the multiplexed stream.
+type streamKey struct {
+	chID  channel.ID
+	topic message.StreamTopic
+}
+
+// muxStream is a multiplexed order book stream. Each subscription runs its own
+// topic stream, whose frames are tagged and funneled into a single queue that
+// is written to the socket.
+type muxStream struct {
+	client *client.Client
+	conn   *websocket.Conn
+	out    chan *message.StreamFrame
+	closed chan struct{}
+
+	mu   sync.Mutex
+	subs map[streamKey]*muxSub
+}
+
+// muxSub is a running subscription of the multiplexed stream. Closing done
+// ends it, and stopped is closed once it sends no more frames.
+type muxSub struct {
+	done, stopped chan struct{}
+}
+
+// serveMuxStream handles the multiplexed mode of /ws/orderbook.
+func serveMuxStream(w http.ResponseWriter, r *http.Request, c *client.Client) {
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("upgrade failed:", err)
+		return
+	}
+	defer conn.Close()
+
+	s := &muxStream{
+		client: c,
+		conn:   conn,
+		out:    make(chan *message.StreamFrame, muxQueueSize),
+		closed: make(chan struct{}),
+		subs:   make(map[streamKey]*muxSub),
+	}
+	defer s.close()
+	go keepAlive(conn, s.closed)
+	go s.writeLoop()
+	go func() {
+		// The stream ends with the client's session.
+		select {
+		case <-c.Done():
+			conn.Close()
+		case <-s.closed:
+		}
+	}()
+
+	for {
+		var req message.JSONObject
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		switch m := req.Message.(type) {
+		case *message.Subscribe:
+			s.subscribe(m)
+		case *message.Unsubscribe:
+			s.unsubscribe(m)
+		default:
+			s.reply(channel.ID{}, "", &message.Error{Err: "unexpected message"})
+		}
+	}
+}
+
+// writeLoop writes the queued frames to the socket until the stream is
+// closed.
+func (s *muxStream) writeLoop() {
+	for {
+		select {
+		case f := <-s.out:
+			if err := writeFrame(s.conn, f); err != nil {
+				s.conn.Close()
+				return
+			}
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// send queues a frame of a subscription. It blocks while the socket is
+// congested, which makes the subscription's own queue overflow and resync
+// eventually.
+func (s *muxStream) send(key streamKey, done <-chan struct{}, msg message.Message) bool {
+	select {
+	case <-done:
+		return false
+	default:
+	}
+	f := &message.StreamFrame{ChannelID: key.chID, Topic: key.topic, Frame: &message.JSONObject{Message: msg}}
+	select {
+	case s.out <- f:
+		return true
+	case <-done:
+		return false
+	case <-s.closed:
+		return false
+	}
+}
+
+// reply queues a control frame for the channel and topic.
+func (s *muxStream) reply(chID channel.ID, topic message.StreamTopic, msg message.Message) {
+	s.send(streamKey{chID, topic}, nil, msg)
+}
+
+func (s *muxStream) subscribe(m *message.Subscribe) {
+	key := streamKey{m.ChannelID, m.Topic}
+	var run func(*orderbook.Book, sendFunc, <-chan struct{})
+	switch m.Topic {
+	case message.TopicBook:
+		run = func(b *orderbook.Book, send sendFunc, done <-chan struct{}) {
+			streamBook(b, m.Since, send, done)
+		}
+	case message.TopicDepth:
+		if m.Levels < 0 {
+			s.reply(m.ChannelID, m.Topic, &message.Error{Err: "invalid levels"})
+			return
+		}
+		run = func(b *orderbook.Book, send sendFunc, done <-chan struct{}) {
+			streamDepth(b, m.Levels, m.Market, send, done)
+		}
+	case message.TopicTrades:
+		run = streamTrades
+	default:
+		s.reply(m.ChannelID, m.Topic, &message.Error{Err: "unknown topic"})
+		return
+	}
+
+	if !s.client.CanStream(m.ChannelID) {
+		s.reply(m.ChannelID, m.Topic, &message.Error{Err: "not authorized for channel"})
+		return
+	}
+
+	s.mu.Lock()
+	if _, ok := s.subs[key]; ok {
+		s.mu.Unlock()
+		s.reply(m.ChannelID, m.Topic, &message.Error{Err: "already subscribed"})
+		return
+	}
+	sub := &muxSub{done: make(chan struct{}), stopped: make(chan struct{})}
+	s.subs[key] = sub
+	s.mu.Unlock()
+
+	// The confirmation is queued before the topic's first frame.
+	s.reply(m.ChannelID, m.Topic, &message.Subscribed{ChannelID: m.ChannelID, Topic: m.Topic})
+	book := client.OrderBookEngine.GetOrCreateBook(m.ChannelID)
+	go func() {
+		defer close(sub.stopped)
+		run(book, func(msg message.Message) bool { return s.send(key, sub.done, msg) }, sub.done)
+	}()
+}
+
+func (s *muxStream) unsubscribe(m *message.Unsubscribe) {
+	key := streamKey{m.ChannelID, m.Topic}
+	s.mu.Lock()
+	sub, ok := s.subs[key]
+	delete(s.subs, key)
+	s.mu.Unlock()
+	if !ok {
+		s.reply(m.ChannelID, m.Topic, &message.Error{Err: "not subscribed"})
+		return
+	}
+	// No frame of the topic may follow the confirmation.
+	close(sub.done)
+	<-sub.stopped
+	s.reply(m.ChannelID, m.Topic, &message.Unsubscribed{ChannelID: m.ChannelID, Topic: m.Topic})
+}
+
+// close ends all subscriptions and the write loop.
+func (s *muxStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, sub := range s.subs {
+		close(sub.done)
+		delete(s.subs, key)
+	}
+	close(s.closed)
+}
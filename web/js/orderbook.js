@@ -40,16 +40,15 @@ class OrderBookManager {
             return;
         }
 
-        const orderId = `order-${Date.now()}-${Math.random().toString(36).substr(2, 9)}`;
+        const clientTag = `order-${Date.now()}-${Math.random().toString(36).substr(2, 9)}`;
 
         window.log(`Creating ${side} order...`, 'info');
 
         try {
-            this.ws.request('CreateOrder', {
+            const response = await this.ws.request('CreateOrder', {
                 order: {
-                    id: orderId,
+                    clientTag: clientTag,
                     channelID: Array.from(this.channelManager.channelId),
-                    makerIdx: this.channelManager.channelIdx,
                     side: side,
                     base: baseAsset,
                     quote: quoteAsset,
@@ -62,7 +61,11 @@ class OrderBookManager {
 
             this.refreshOrderBook();
 
-            window.log(`✅ Order created: ${orderId.substring(0, 16)}...`, 'success');
+            if (response.type === 'CreateOrderAck' && response.message.accepted) {
+                window.log(`✅ Order created: ${response.message.id.substring(0, 16)}...`, 'success');
+            } else {
+                window.log(`Order rejected: ${response.message.reason || response.message.error}`, 'error');
+            }
         } catch (err) {
             window.log(`Failed to create order: ${err.message}`, 'error');
         }
@@ -92,8 +95,8 @@ class OrderBookManager {
         const confirmed = confirm(
             'Accept this order?\n\n' +
             'This will:\n' +
-            '1. Accept the order in the order book\n' +
-            '2. Automatically settle trade via channel update\n\n' +
+            '1. Reserve the order in the order book\n' +
+            '2. Settle the trade via a channel update\n\n' +
             'Continue?'
         );
         if (!confirmed) return;
@@ -101,125 +104,22 @@ class OrderBookManager {
         window.log(`Accepting order ${orderId.substring(0, 16)}...`, 'info');
 
         try {
-            // 1. Accept the order on the order book
-            this.ws.request('AcceptOrder', {
-                channelID: Array.from(this.channelManager.channelId),
-                id: orderId
-            });
-            window.log(`✅ Order accepted. Settling in channel...`, 'success');
-
-            this.ws.request('CancelOrder', {
+            // The server computes the balance transfer from the order and
+            // settles it with a channel update before answering.
+            const response = await this.ws.request('AcceptOrder', {
                 channelID: Array.from(this.channelManager.channelId),
                 id: orderId
             });
 
-            // 2. Locate order
-            const order = this.bids.concat(this.asks).find(o => o.id === orderId);
-            if (!order) {
-                window.log('Order not found locally. Refresh and retry.', 'error');
-                return;
-            }
-
-            // 3. Get channel state
-            const chState = this.channelManager.getState();
-            if (!chState.channelId || chState.channelIdx === null) {
-                window.log('No active channel found.', 'error');
-                return;
-            }
-
-            await initAssets();
-            if (!ETH_ASSET || !SOL_ASSET) {
-                window.log("Assets not initialized.", "error");
-                return;
-            }
-
-            const assets = [ETH_ASSET, SOL_ASSET]; // ETH index 0, SOL index 1
-
-            const myIdx = this.channelManager.channelIdx; // always taker
-            const peerIdx = 1 - myIdx;
-
-            let bals = chState.balances ? [...chState.balances.my] : [];
-            let peerBals = chState.balances ? [...chState.balances.peer] : [];
-
-            const makerIdx = order.makerIdx;
-            const takerIdx = 1 - makerIdx;
-
-            // Ensure correct BigInt initialization
-            bals = bals.map(x => BigInt(x));
-            peerBals = peerBals.map(x => BigInt(x));
-
-            // 4. Asset and amount calculations
-            const baseAsset = order.base;
-            const quoteAsset = order.quote;
-            const baseSymbol = baseAsset.asset.assetType === 'Ethereum' ? 'ETH' : 'SOL';
-            const quoteSymbol = quoteAsset.asset.assetType === 'Ethereum' ? 'ETH' : 'SOL';
-
-            const baseDecimals = baseSymbol === 'ETH' ? 1e18 : 1e9;
-            const quoteDecimals = quoteSymbol === 'ETH' ? 1e18 : 1e9;
-
-            const baseAmount = BigInt(Math.round(parseFloat(order.amount) * baseDecimals));
-            const quoteAmount = BigInt(Math.round(parseFloat(order.amount) * parseFloat(order.price) * quoteDecimals));
-
-            const idxFor = sym => (sym === 'ETH' ? 0 : 1);
-            const add = (arr, sym, amt) => { arr[idxFor(sym)] = arr[idxFor(sym)] + amt; };
-            const sub = (arr, sym, amt) => { arr[idxFor(sym)] = arr[idxFor(sym)] - amt; };
-
-            console.log(`Settling trade: ${order.side} ${order.amount} ${baseSymbol} @ ${order.price} ${quoteSymbol}`);
-            console.log(`baseAmt=${baseAmount}, quoteAmt=${quoteAmount}`);
-            console.log(`I am taker (acceptOrder caller). MakerIdx=${makerIdx}`);
-
-            // 5. Mirror updates (taker perspective)
-            if (order.side === 'bid') {
-                // Maker buys base, pays quote
-                // Taker sells base, receives quote
-
-                // Taker (me)
-                add(bals, quoteSymbol, quoteAmount); // receive quote
-                sub(bals, baseSymbol, baseAmount);   // send base
-
-                // Maker (peer)
-                sub(peerBals, quoteSymbol, quoteAmount);
-                add(peerBals, baseSymbol, baseAmount);
-            } else if (order.side === 'ask') {
-                // Maker sells base, receives quote
-                // Taker buys base, pays quote
-
-                // Taker (me)
-                sub(bals, quoteSymbol, quoteAmount); // pay quote
-                add(bals, baseSymbol, baseAmount);   // receive base
-
-                // Maker (peer)
-                add(peerBals, quoteSymbol, quoteAmount);
-                sub(peerBals, baseSymbol, baseAmount);
+            if (response.type === 'AcceptOrderAck' && response.message.accepted) {
+                window.log(`✅ Trade settled: ${response.message.amount} filled`, 'success');
             } else {
-                window.log(`Invalid order side: ${order.side}`, 'error');
-                return;
+                window.log(`❌ Accept failed: ${response.message.reason}`, 'error');
             }
-
-            // Convert back to strings for serialization
-            bals = bals.map(x => x.toString());
-            peerBals = peerBals.map(x => x.toString());
-
-            // 6. Submit update
-            const updateRequest = {
-                id: Array.from(this.channelManager.channelId),
-                state: {
-                    balance: bals,
-                    peerBalance: peerBals,
-                    assets: assets,
-                    backends: [1, 6], // ETH idx=1, SOL idx=6 (adjust as per backend)
-                    isFinal: false
-                }
-            };
-
-            window.log('Submitting UpdateChannel: ' + JSON.stringify(updateRequest), 'info');
-            this.ws.request('UpdateChannel', updateRequest);
-
-            window.log('✅ Channel updated. Trade settled!', 'success');
+            this.refreshOrderBook();
             this.channelManager.refreshChannelInfo();
-
         } catch (err) {
-            window.log(`Failed to accept order or update channel: ${err.message}`, 'error');
+            window.log(`Failed to accept order: ${err.message}`, 'error');
         }
     }
 
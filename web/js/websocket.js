@@ -54,6 +54,13 @@ class WSConnection {
             return;
         }
 
+        // Prove control of the wallet addresses before the server restores
+        // the client's L2 identity
+        if (data.type === 'AuthChallenge') {
+            this.handleAuthChallenge(data.message.challenge);
+            return;
+        }
+
         // Check for Initialized message
         if (data.type === 'Initialized') {
             this.connected = true;
@@ -82,6 +89,28 @@ class WSConnection {
         }
     }
 
+    async handleAuthChallenge(challenge) {
+        try {
+            const ethSignature = await this.walletManager.signEthereumMessage(challenge);
+            const ethSigBytes = [];
+            for (let i = 2; i < ethSignature.length; i += 2) {
+                ethSigBytes.push(parseInt(ethSignature.substr(i, 2), 16));
+            }
+            const solSignature = await this.walletManager.signSolanaMessage(challenge);
+
+            const response = {
+                type: 'AuthResponse',
+                message: {
+                    ethSignature: ethSigBytes,
+                    solSignature: solSignature
+                }
+            };
+            this.ws.send(JSON.stringify(response));
+        } catch (error) {
+            window.log(`❌ Signing login challenge failed: ${error.message}`, 'error');
+        }
+    }
+
     async handleEthSignRequest(data) {
         try {
             const hexData = Array.isArray(data.data)